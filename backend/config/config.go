@@ -0,0 +1,288 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/tracing"
+	"github.com/sykell/backend/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the backend reads at startup. It comes from an
+// optional YAML file, with environment variables taking precedence.
+type Config struct {
+	Server    ServerConfig        `yaml:"server"`
+	Database  DatabaseConfig      `yaml:"database"`
+	Auth      AuthConfig          `yaml:"auth"`
+	CORS      CORSConfig          `yaml:"cors"`
+	Crawler   utils.CrawlerConfig `yaml:"crawler"`
+	Analysis  AnalysisConfig      `yaml:"analysis"`
+	RateLimit RateLimitConfig     `yaml:"rate_limit"`
+	Log       LogConfig           `yaml:"log"`
+	Tracing   tracing.Config      `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"`
+	// GinMode is debug, release or test
+	GinMode string `yaml:"gin_mode"`
+	// ShutdownTimeout is how long in-flight requests and analyses get to finish
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// MetricsAddress is where /metrics is served, apart from the API as it
+	// has no auth; empty turns it off
+	MetricsAddress string `yaml:"metrics_address"`
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For is believed
+	// when logging and auditing the client IP; empty trusts none
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+}
+
+// DSN is the MySQL data source name for the database.
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		d.User, d.Password, d.Host, d.Port, d.Name)
+}
+
+type AuthConfig struct {
+	// AdminAPIKey lets the first keys be created through the API; it is
+	// required in release mode
+	AdminAPIKey string `yaml:"admin_api_key"`
+	// FrontendAPIKey is created with only the URL scopes, for the web frontend
+	FrontendAPIKey string `yaml:"frontend_api_key"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins may call the API from a browser; "*" allows any. None
+	// are allowed by default, and release mode requires a list.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+type AnalysisConfig struct {
+	// Workers is the size of the analysis worker pool
+	Workers int `yaml:"workers"`
+}
+
+type RateLimitConfig struct {
+	// RequestsPerSecond refills each API key's budget; 0 disables the limit
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error and Format is text or json
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// Default returns the settings used when nothing is configured.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            8080,
+			GinMode:         gin.DebugMode,
+			ShutdownTimeout: 30 * time.Second,
+			MetricsAddress:  ":9090",
+		},
+		Database:  DatabaseConfig{Host: "localhost", Port: 3306},
+		Crawler:   utils.DefaultCrawlerConfig(),
+		Analysis:  AnalysisConfig{Workers: 4},
+		RateLimit: RateLimitConfig{RequestsPerSecond: utils.DefaultAPIRequestsPerSecond, Burst: utils.DefaultAPIBurst},
+		Log:       LogConfig{Level: "info", Format: logging.FormatText},
+		Tracing:   tracing.DefaultConfig(),
+	}
+}
+
+// Load reads the YAML file at path, if any, over the defaults, applies
+// environment overrides and validates the result.
+func Load(path string) (Config, error) {
+	return load(path, os.LookupEnv)
+}
+
+func load(path string, lookup func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return cfg, err
+		}
+		defer f.Close()
+
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	for _, env := range cfg.envVars() {
+		value, ok := lookup(env.name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := env.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", env.name, value, err))
+		}
+	}
+	if len(errs) > 0 {
+		return cfg, errors.Join(errs...)
+	}
+	return cfg, cfg.Validate()
+}
+
+type envVar struct {
+	name string
+	set  func(string) error
+}
+
+// envVars lists the environment variables that override each setting.
+func (c *Config) envVars() []envVar {
+	return []envVar{
+		{"PORT", intVar(&c.Server.Port)},
+		{"GIN_MODE", stringVar(&c.Server.GinMode)},
+		{"SHUTDOWN_TIMEOUT", durationVar(&c.Server.ShutdownTimeout)},
+		{"METRICS_ADDRESS", stringVar(&c.Server.MetricsAddress)},
+		{"TRUSTED_PROXIES", listVar(&c.Server.TrustedProxies)},
+		{"DB_HOST", stringVar(&c.Database.Host)},
+		{"DB_PORT", intVar(&c.Database.Port)},
+		{"DB_USER", stringVar(&c.Database.User)},
+		{"DB_PASSWORD", stringVar(&c.Database.Password)},
+		{"DB_NAME", stringVar(&c.Database.Name)},
+		{"ADMIN_API_KEY", stringVar(&c.Auth.AdminAPIKey)},
+		{"FRONTEND_API_KEY", stringVar(&c.Auth.FrontendAPIKey)},
+		{"CORS_ALLOWED_ORIGINS", listVar(&c.CORS.AllowedOrigins)},
+		{"CRAWLER_FETCH_TIMEOUT", durationVar(&c.Crawler.FetchTimeout)},
+		{"CRAWLER_LINK_CHECK_TIMEOUT", durationVar(&c.Crawler.LinkCheckTimeout)},
+		{"CRAWLER_ROBOTS_TIMEOUT", durationVar(&c.Crawler.RobotsTimeout)},
+		{"CRAWLER_MAX_CHECKED_LINKS", intVar(&c.Crawler.MaxCheckedLinks)},
+		{"CRAWLER_USER_AGENT", stringVar(&c.Crawler.UserAgent)},
+		{"CRAWLER_MAX_CONNS_PER_HOST", intVar(&c.Crawler.MaxConnsPerHost)},
+		{"CRAWLER_HOST_REQUESTS_PER_SECOND", floatVar(&c.Crawler.HostRequestsPerSecond)},
+		{"ANALYSIS_WORKERS", intVar(&c.Analysis.Workers)},
+		{"API_RATE_LIMIT", floatVar(&c.RateLimit.RequestsPerSecond)},
+		{"API_RATE_BURST", intVar(&c.RateLimit.Burst)},
+		{"LOG_LEVEL", stringVar(&c.Log.Level)},
+		{"LOG_FORMAT", stringVar(&c.Log.Format)},
+		// The OpenTelemetry SDK's standard names
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", stringVar(&c.Tracing.Endpoint)},
+		{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", stringVar(&c.Tracing.TracesEndpoint)},
+		{"OTEL_SERVICE_NAME", stringVar(&c.Tracing.ServiceName)},
+	}
+}
+
+func stringVar(p *string) func(string) error {
+	return func(s string) error {
+		*p = s
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.Atoi(s)
+		return err
+	}
+}
+
+func floatVar(p *float64) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.ParseFloat(s, 64)
+		return err
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(s string) (err error) {
+		*p, err = time.ParseDuration(s)
+		return err
+	}
+}
+
+// listVar parses a comma-separated list
+func listVar(p *[]string) func(string) error {
+	return func(s string) error {
+		*p = nil
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	}
+}
+
+// Validate reports every setting the backend cannot start with.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port >= 1 && c.Server.Port <= 65535, "server.port must be between 1 and 65535")
+	check(c.Server.GinMode == gin.DebugMode || c.Server.GinMode == gin.ReleaseMode || c.Server.GinMode == gin.TestMode,
+		"server.gin_mode must be debug, release or test")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	if c.Server.MetricsAddress != "" {
+		_, port, err := net.SplitHostPort(c.Server.MetricsAddress)
+		check(err == nil && port != strconv.Itoa(c.Server.Port), "server.metrics_address must be a host:port apart from the API port")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		check(err == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies: %q is not an IP or CIDR", proxy)
+	}
+
+	check(c.Database.Host != "", "database.host is required")
+	check(c.Database.Port >= 1 && c.Database.Port <= 65535, "database.port must be between 1 and 65535")
+	check(c.Database.User != "", "database.user is required")
+	check(c.Database.Name != "", "database.name is required")
+
+	check(c.Auth.AdminAPIKey != "" || c.Server.GinMode != gin.ReleaseMode, "auth.admin_api_key is required in release mode")
+	check(c.Auth.FrontendAPIKey == "" || c.Auth.FrontendAPIKey != c.Auth.AdminAPIKey,
+		"auth.frontend_api_key must not be the admin key")
+
+	check(len(c.CORS.AllowedOrigins) > 0 || c.Server.GinMode != gin.ReleaseMode, "cors.allowed_origins is required in release mode")
+	for _, origin := range c.CORS.AllowedOrigins {
+		u, err := url.Parse(origin)
+		check(origin == "*" || (err == nil && u.Scheme != "" && u.Host != "" && strings.Trim(u.Path, "/") == ""),
+			"cors.allowed_origins: %q is not \"*\" or a scheme and host", origin)
+	}
+
+	if err := c.Crawler.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("crawler.%w", err))
+	}
+
+	check(c.Analysis.Workers >= 1, "analysis.workers must be at least 1")
+	check(c.RateLimit.RequestsPerSecond >= 0, "rate_limit.requests_per_second must not be negative")
+	check(c.RateLimit.Burst >= 1, "rate_limit.burst must be at least 1")
+
+	if _, err := logging.New(io.Discard, c.Log.Level, c.Log.Format); err != nil {
+		errs = append(errs, fmt.Errorf("log: %w", err))
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("tracing.%w", err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
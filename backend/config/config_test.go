@@ -0,0 +1,157 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: 9090
+database:
+  host: db
+  user: sykell
+  name: sykell
+cors:
+  allowed_origins: ["https://app.example"]
+crawler:
+  max_checked_links: 25
+  fetch_timeout: 20s
+`)
+
+	cfg, err := load(path, env(map[string]string{
+		"PORT":                        "9191",
+		"CRAWLER_USER_AGENT":          "TestBot/1.0",
+		"CORS_ALLOWED_ORIGINS":        "https://a.example, https://b.example",
+		"ANALYSIS_WORKERS":            "",
+		"CRAWLER_LINK_CHECK_TIMEOUT":  "2s",
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+	}))
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	if cfg.Server.Port != 9191 {
+		t.Errorf("Server.Port = %d, want the environment's 9191", cfg.Server.Port)
+	}
+	if cfg.Database.Host != "db" || cfg.Database.Port != 3306 {
+		t.Errorf("Database = %s:%d, want db from the file and the default port", cfg.Database.Host, cfg.Database.Port)
+	}
+	if cfg.Crawler.MaxCheckedLinks != 25 || cfg.Crawler.FetchTimeout != 20*time.Second {
+		t.Errorf("Crawler = %+v, want max_checked_links and fetch_timeout from the file", cfg.Crawler)
+	}
+	if cfg.Crawler.UserAgent != "TestBot/1.0" || cfg.Crawler.LinkCheckTimeout != 2*time.Second {
+		t.Errorf("Crawler = %+v, want user agent and link check timeout from the environment", cfg.Crawler)
+	}
+	if got := strings.Join(cfg.CORS.AllowedOrigins, " "); got != "https://a.example https://b.example" {
+		t.Errorf("CORS.AllowedOrigins = %q, want the environment's list", got)
+	}
+	if cfg.Tracing.Endpoint != "http://collector:4318" || cfg.Tracing.ServiceName != "sykell-backend" {
+		t.Errorf("Tracing = %+v, want the environment's endpoint and the default service name", cfg.Tracing)
+	}
+	if cfg.Analysis.Workers != 4 {
+		t.Errorf("Analysis.Workers = %d, want the default 4 for an empty variable", cfg.Analysis.Workers)
+	}
+}
+
+// withDatabase adds the database settings that have no defaults to vars
+func withDatabase(vars map[string]string) map[string]string {
+	vars["DB_USER"], vars["DB_NAME"] = "sykell", "sykell"
+	return vars
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "unknown field",
+			file: "server:\n  prot: 8080\n",
+			env:  withDatabase(map[string]string{}),
+			want: []string{"field prot not found"},
+		},
+		{
+			name: "unparsable variable",
+			env:  withDatabase(map[string]string{"SHUTDOWN_TIMEOUT": "soon"}),
+			want: []string{"invalid SHUTDOWN_TIMEOUT"},
+		},
+		{
+			name: "every invalid setting",
+			env: withDatabase(map[string]string{
+				"PORT":                        "70000",
+				"GIN_MODE":                    "production",
+				"CORS_ALLOWED_ORIGINS":        "app.example",
+				"CRAWLER_MAX_CONNS_PER_HOST":  "0",
+				"ANALYSIS_WORKERS":            "0",
+				"LOG_FORMAT":                  "xml",
+				"ADMIN_API_KEY":               "shared-secret",
+				"FRONTEND_API_KEY":            "shared-secret",
+				"TRUSTED_PROXIES":             "10.0.0.0/8, proxy.internal",
+				"METRICS_ADDRESS":             "9090",
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318",
+			}),
+			want: []string{
+				"server.port", "server.gin_mode", "server.metrics_address", "server.trusted_proxies", "cors.allowed_origins", "crawler.max_conns_per_host",
+				"analysis.workers", "log format", "auth.frontend_api_key", "tracing.endpoint",
+			},
+		},
+		{
+			name: "release without admin key or origins",
+			env:  withDatabase(map[string]string{"GIN_MODE": "release"}),
+			want: []string{"auth.admin_api_key is required", "cors.allowed_origins is required"},
+		},
+		{
+			name: "missing database",
+			env:  map[string]string{},
+			want: []string{"database.user is required", "database.name is required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+
+			_, err := load(path, env(tt.env))
+			if err == nil {
+				t.Fatal("load() succeeded, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("load() error = %q, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	if _, err := load("../config.example.yaml", env(map[string]string{"ADMIN_API_KEY": "example-admin-key"})); err != nil {
+		t.Fatalf("config.example.yaml: %v", err)
+	}
+}
@@ -1,45 +1,79 @@
 package config
 
 import (
-	"fmt"
-	"log"
-	"os"
+	"log/slog"
 
+	"github.com/sykell/backend/logging"
 	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/tracing"
+	"github.com/sykell/backend/utils"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
-
-func InitDB() {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
-
-	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+// InitDB connects to the database and migrates its schema.
+func InitDB(cfg DatabaseConfig) *gorm.DB {
+	db, err := gorm.Open(mysql.Open(cfg.DSN()), &gorm.Config{
+		Logger: logging.NewGormLogger(slog.Default(), logging.DefaultSlowQuery),
 	})
 
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal("Failed to connect to database", "error", err)
+	}
+
+	// Trace every query; spans attach to the request or job when the query
+	// is made with its context
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		logging.Fatal("Failed to install GORM tracing", "error", err)
 	}
 
 	// Auto migrate the schema
-	err = DB.AutoMigrate(&models.URL{}, &models.AnalysisResult{}, &models.BrokenLink{})
+	err = db.AutoMigrate(&models.URL{}, &models.AnalysisResult{}, &models.BrokenLink{}, &models.AnalysisJob{},
+		&models.Webhook{}, &models.WebhookDelivery{}, &models.APIKey{}, &models.Workspace{},
+		&models.AuditLog{}, &models.AnalysisUsage{})
 	if err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+		logging.Fatal("Failed to migrate database", "error", err)
 	}
 
-	log.Println("Database connected and migrated successfully")
+	// The model's hooks only guard GORM's Update and Delete, so the database
+	// enforces the append-only audit log as well. Creating triggers may need
+	// extra privileges when binary logging is on.
+	if err := utils.EnsureAuditLogTriggers(db); err != nil {
+		slog.Warn("Audit log is append-only in the application only", "error", err)
+	}
+
+	// Existing rows default to workspace 1, so it has to exist
+	err = db.Where(models.Workspace{ID: models.DefaultWorkspaceID}).
+		Attrs(models.Workspace{Name: "Default"}).
+		FirstOrCreate(&models.Workspace{}).Error
+	if err != nil {
+		logging.Fatal("Failed to create default workspace", "error", err)
+	}
+
+	// Site crawls store several results per URL, so the old one-result-per-URL
+	// unique index has to go.
+	if db.Migrator().HasIndex(&models.AnalysisResult{}, "idx_analysis_results_url_id") {
+		if err := db.Migrator().DropIndex(&models.AnalysisResult{}, "idx_analysis_results_url_id"); err != nil {
+			logging.Fatal("Failed to drop legacy analysis index", "error", err)
+		}
+	}
+
+	// URLs are now unique per workspace rather than globally
+	if db.Migrator().HasIndex(&models.URL{}, "idx_urls_url") {
+		if err := db.Migrator().DropIndex(&models.URL{}, "idx_urls_url"); err != nil {
+			logging.Fatal("Failed to drop legacy URL index", "error", err)
+		}
+	}
+
+	slog.Info("Database connected and migrated successfully")
+	return db
 }
 
-func GetDB() *gorm.DB {
-	return DB
-} 
\ No newline at end of file
+// CloseDB closes the database connection pool.
+func CloseDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
\ No newline at end of file
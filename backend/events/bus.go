@@ -0,0 +1,217 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+)
+
+const (
+	// DefaultHistorySize is how many recent events are kept for reconnecting clients
+	DefaultHistorySize = 1024
+	// subscriberBuffer is how many events may wait for a slow subscriber
+	// before it is disconnected
+	subscriberBuffer = 64
+)
+
+type Type string
+
+const (
+	// TypeStatus events report a URL moving to a new status
+	TypeStatus Type = "status"
+	// TypeProgress events report what a running analysis is doing
+	TypeProgress Type = "progress"
+)
+
+// Event is one message on the bus. IDs increase by one per event and restart
+// from 1 when the process restarts, so streams identify events by EventID.
+type Event struct {
+	ID    uint64 `json:"id"`
+	Type  Type   `json:"type"`
+	URLID uint   `json:"url_id"`
+	// WorkspaceID is used to keep streams to their own workspace
+	WorkspaceID uint                 `json:"-"`
+	JobID       uint                 `json:"job_id"`
+	Status      string               `json:"status,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Progress    *utils.CrawlProgress `json:"progress,omitempty"`
+	Time        time.Time            `json:"time"`
+}
+
+// Bus fans analysis events out to subscribers and keeps a short history so
+// clients can resume after a reconnect. A nil *Bus discards everything.
+type Bus struct {
+	mu sync.Mutex
+	// epoch tells this process's event IDs apart from a previous run's
+	epoch   string
+	lastID  uint64
+	history []Event
+	size    int
+	subs    map[*Subscription]struct{}
+	closed  bool
+}
+
+func NewBus(historySize int) *Bus {
+	if historySize < 1 {
+		historySize = DefaultHistorySize
+	}
+	return &Bus{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:  historySize,
+		subs:  make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events matching its filter on C. C is closed
+// when the subscription ends, including when the subscriber falls too far
+// behind; it should then reconnect with the last ID it saw.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	filter func(Event) bool
+	bus    *Bus
+}
+
+// Publish assigns the event an ID and timestamp and delivers it.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	if len(b.history) == b.size {
+		b.history = b.history[1:]
+	}
+	b.history = append(b.history, event)
+
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Never block publishers on a slow reader
+			b.remove(sub)
+		}
+	}
+}
+
+// EventID identifies the event to stream clients: the bus's epoch and the
+// event's ID, so IDs from before a restart are never mistaken for new ones.
+func (b *Bus) EventID(event Event) string {
+	return b.epoch + "-" + strconv.FormatUint(event.ID, 10)
+}
+
+// Subscribe registers a subscriber for events accepted by filter (nil accepts
+// everything). If lastEventID, as returned by EventID, is not empty, the
+// matching events published since then are returned for replay. complete is
+// false when some of those events are no longer in the history, or the ID is
+// not one of this process's, in which case the client should refetch its
+// state instead of relying on the replay.
+func (b *Bus) Subscribe(lastEventID string, filter func(Event) bool) (sub *Subscription, replay []Event, complete bool) {
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, filter: filter, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastEventID != "" {
+		epoch, seq, _ := strings.Cut(lastEventID, "-")
+		lastID, err := strconv.ParseUint(seq, 10, 64)
+		oldest := b.lastID + 1
+		if len(b.history) > 0 {
+			oldest = b.history[0].ID
+		}
+		complete = epoch == b.epoch && err == nil && lastID+1 >= oldest && lastID <= b.lastID
+
+		if epoch == b.epoch && err == nil {
+			for _, event := range b.history {
+				if event.ID > lastID && (filter == nil || filter(event)) {
+					replay = append(replay, event)
+				}
+			}
+		}
+	}
+
+	if b.closed {
+		close(ch)
+		return sub, replay, complete
+	}
+	b.subs[sub] = struct{}{}
+	return sub, replay, complete
+}
+
+// Close ends every subscription, and any made afterwards right away, so that
+// open event streams do not hold up a server shutdown.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove drops a subscriber. Callers hold b.mu.
+func (b *Bus) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// AnalysisStatusChanged is a jobs.StatusListener that publishes the URL
+// status implied by the job's new status.
+func (b *Bus) AnalysisStatusChanged(job models.AnalysisJob) {
+	status := job.Status
+	if models.JobStatus(status) == models.JobFailed {
+		status = string(models.StatusError)
+	}
+	b.Publish(Event{
+		Type:        TypeStatus,
+		URLID:       job.URLID,
+		WorkspaceID: job.WorkspaceID,
+		JobID:       job.ID,
+		Status:      status,
+		Error:       job.Error,
+	})
+}
+
+// ProgressReporter returns a CrawlOptions.Progress callback that publishes
+// progress events for the job.
+func (b *Bus) ProgressReporter(job *models.AnalysisJob) func(utils.CrawlProgress) {
+	if b == nil {
+		return nil
+	}
+	return func(progress utils.CrawlProgress) {
+		b.Publish(Event{
+			Type:        TypeProgress,
+			URLID:       job.URLID,
+			WorkspaceID: job.WorkspaceID,
+			JobID:       job.ID,
+			Progress:    &progress,
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/sykell/backend/models"
+)
+
+func TestBusFilterAndReplay(t *testing.T) {
+	bus := NewBus(3)
+	onlyURL2 := func(event Event) bool { return event.URLID == 2 }
+
+	live, _, _ := bus.Subscribe("", onlyURL2)
+	defer live.Close()
+
+	for i := 1; i <= 4; i++ {
+		bus.Publish(Event{Type: TypeStatus, URLID: uint(i%2 + 1), Status: "running"})
+	}
+
+	if got := len(live.C); got != 2 {
+		t.Fatalf("filtered subscriber got %d events, want 2", got)
+	}
+	if event := <-live.C; event.ID != 1 || event.URLID != 2 {
+		t.Errorf("first event = %+v, want ID 1 for URL 2", event)
+	}
+
+	// The history now holds events 2-4, of which only 3 is for URL 2
+	eventID := func(id uint64) string { return bus.EventID(Event{ID: id}) }
+	tests := []struct {
+		name         string
+		lastEventID  string
+		wantIDs      []uint64
+		wantComplete bool
+	}{
+		{"fresh subscription", "", nil, true},
+		{"resume within history", eventID(2), []uint64{3}, true},
+		{"resume just before history", eventID(1), []uint64{3}, true},
+		{"id ahead of ours", eventID(99), nil, false},
+		{"id from before restart", "0-2", nil, false},
+		{"malformed id", "2", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, replay, complete := bus.Subscribe(tt.lastEventID, onlyURL2)
+			defer sub.Close()
+
+			var ids []uint64
+			for _, event := range replay {
+				ids = append(ids, event.ID)
+			}
+			if len(ids) != len(tt.wantIDs) || (len(ids) > 0 && ids[0] != tt.wantIDs[0]) {
+				t.Errorf("replayed %v, want %v", ids, tt.wantIDs)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestBusDetectsLostHistory(t *testing.T) {
+	bus := NewBus(2)
+	for i := 0; i < 5; i++ {
+		bus.Publish(Event{Type: TypeStatus, URLID: 1})
+	}
+
+	// Events 4 and 5 are kept; event 3 after ID 2 is lost
+	sub, replay, complete := bus.Subscribe(bus.EventID(Event{ID: 2}), nil)
+	defer sub.Close()
+	if complete {
+		t.Error("Subscribe() reported a complete replay after history was trimmed")
+	}
+	if len(replay) != 2 || replay[0].ID != 4 {
+		t.Errorf("replay = %+v, want events 4 and 5", replay)
+	}
+}
+
+func TestBusDropsSlowSubscriber(t *testing.T) {
+	bus := NewBus(0)
+	sub, _, _ := bus.Subscribe("", nil)
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.AnalysisStatusChanged(models.AnalysisJob{ID: 1, URLID: 1, Status: string(models.JobFailed)})
+	}
+
+	received := 0
+	for event := range sub.C {
+		if event.Status != string(models.StatusError) {
+			t.Fatalf("status = %q, want failed jobs reported as %q", event.Status, models.StatusError)
+		}
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before the channel closed, want %d", received, subscriberBuffer)
+	}
+
+	// Closing an already dropped subscription is harmless
+	sub.Close()
+}
+
+func TestBusClose(t *testing.T) {
+	bus := NewBus(3)
+	before, _, _ := bus.Subscribe("", nil)
+
+	bus.Close()
+	if _, ok := <-before.C; ok {
+		t.Error("subscription made before Close is still open")
+	}
+	before.Close()
+
+	after, _, _ := bus.Subscribe("", nil)
+	if _, ok := <-after.C; ok {
+		t.Error("subscription made after Close is still open")
+	}
+	after.Close()
+}
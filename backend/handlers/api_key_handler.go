@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+	"gorm.io/gorm"
+)
+
+type APIKeyHandler struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// CreateAPIKey handles POST /api/keys
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	response, err := createAPIKey(h.db.WithContext(c.Request.Context()), models.APIKey{
+		WorkspaceID:        utils.CurrentWorkspaceID(c),
+		Name:               req.Name,
+		Scopes:             strings.Join(req.Scopes, ","),
+		DailyAnalysisQuota: req.DailyAnalysisQuota,
+		ExpiresAt:          req.ExpiresAt,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create key"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditKeyCreate, "key", []uint{response.ID}, gin.H{"name": response.Name, "scopes": response.Scopes})
+	c.JSON(http.StatusCreated, response)
+}
+
+// createAPIKey generates a secret for apiKey and stores it.
+func createAPIKey(db *gorm.DB, apiKey models.APIKey) (models.CreateAPIKeyResponse, error) {
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		return models.CreateAPIKeyResponse{}, err
+	}
+	apiKey.Prefix = prefix
+	apiKey.Hash = hash
+	if err := db.Create(&apiKey).Error; err != nil {
+		return models.CreateAPIKeyResponse{}, err
+	}
+	return models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+// GetAPIKeys handles GET /api/keys
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := h.db.WithContext(c.Request.Context()).Where("workspace_id = ?", utils.CurrentWorkspaceID(c)).Order("id").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// RevokeAPIKey handles DELETE /api/keys/:id
+// Revoked keys stay listed so their last use can still be seen.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := h.db.WithContext(c.Request.Context()).Where("workspace_id = ?", utils.CurrentWorkspaceID(c)).First(&apiKey, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		if err := h.db.WithContext(c.Request.Context()).Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke key"})
+			return
+		}
+		utils.RecordAudit(c, h.db, models.AuditKeyRevoke, "key", []uint{apiKey.ID}, nil)
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+	"gorm.io/gorm"
+)
+
+type AuditHandler struct {
+	db *gorm.DB
+}
+
+func NewAuditHandler(db *gorm.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+// GetAuditLogs handles GET /api/audit-logs
+// It lists the workspace's audit log, newest first, optionally filtered by
+// action, api_key_id, target_type, target_id and a since/until time range.
+func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.AuditLog{}).Where("workspace_id = ?", utils.CurrentWorkspaceID(c))
+
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if raw := c.Query("api_key_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid api_key_id"})
+			return
+		}
+		query = query.Where("api_key_id = ?", id)
+	}
+	if raw := c.Query("target_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target_id"})
+			return
+		}
+		query = query.Where("target_ids LIKE ?", fmt.Sprintf("%%,%d,%%", id))
+	}
+	for _, bound := range []struct {
+		param  string
+		clause string
+	}{
+		{"since", "created_at >= ?"},
+		{"until", "created_at < ?"},
+	} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be an RFC 3339 timestamp"})
+			return
+		}
+		query = query.Where(bound.clause, at)
+	}
+
+	var entries []models.AuditLog
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	response := models.AuditLogListResponse{
+		Entries:    entries,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/events"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+)
+
+// heartbeatInterval keeps idle streams alive through proxies
+const heartbeatInterval = 15 * time.Second
+
+type EventsHandler struct {
+	bus     *events.Bus
+	tickets *utils.StreamTickets
+}
+
+func NewEventsHandler(bus *events.Bus, tickets *utils.StreamTickets) *EventsHandler {
+	return &EventsHandler{bus: bus, tickets: tickets}
+}
+
+// CreateStreamTicket handles POST /api/events/ticket
+// It returns a ticket for clients that cannot send headers, such as browser
+// EventSource, to open one event stream with instead of their API key.
+func (h *EventsHandler) CreateStreamTicket(c *gin.Context) {
+	ticket, expiresAt, err := h.tickets.Issue(utils.CurrentAPIKey(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream ticket"})
+		return
+	}
+	c.JSON(http.StatusCreated, models.StreamTicketResponse{Ticket: ticket, ExpiresAt: expiresAt})
+}
+
+// StreamEvents handles GET /api/events?url_ids=1,2,3
+// It streams status and progress events as Server-Sent Events, for every URL
+// in the caller's workspace or only the listed ones. Reconnecting clients send
+// Last-Event-ID (or the last_event_id query parameter) to receive the events
+// they missed; if those are no longer available, or the server has restarted
+// since, a "reset" event tells them to refetch.
+func (h *EventsHandler) StreamEvents(c *gin.Context) {
+	workspaceID := utils.CurrentWorkspaceID(c)
+	filter := func(event events.Event) bool { return event.WorkspaceID == workspaceID }
+	if raw := c.Query("url_ids"); raw != "" {
+		ids := make(map[uint]bool)
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID in url_ids"})
+				return
+			}
+			ids[uint(id)] = true
+		}
+		filter = func(event events.Event) bool { return event.WorkspaceID == workspaceID && ids[event.URLID] }
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	sub, replay, complete := h.bus.Subscribe(lastEventID, filter)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !complete {
+		c.Render(-1, sse.Event{Event: "reset", Data: gin.H{"message": "Missed events are no longer available, refetch state"}})
+	}
+	for _, event := range replay {
+		h.renderEvent(c, event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, or the server is shutting down;
+				// the client reconnects and resumes
+				return
+			}
+			h.renderEvent(c, event)
+		case <-heartbeat.C:
+			c.Writer.WriteString(": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+func (h *EventsHandler) renderEvent(c *gin.Context, event events.Event) {
+	c.Render(-1, sse.Event{
+		Id:    h.bus.EventID(event),
+		Event: string(event.Type),
+		Data:  event,
+	})
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many URLs are loaded and written at a time
+const exportBatchSize = 500
+
+// exportWriter encodes URL export records in one output format.
+type exportWriter interface {
+	Write(record models.URLExport) error
+	// Flush pushes buffered output to the client
+	Flush() error
+	// Close writes any trailer
+	Close() error
+}
+
+// ExportURLs handles GET /api/urls/export?format=csv|json|ndjson&include=broken_links
+// It takes the same search, status and sort parameters as GET /api/urls and
+// streams every matching URL with its latest analysis.
+func (h *URLHandler) ExportURLs(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	includeBrokenLinks := c.Query("include") == "broken_links"
+
+	var contentType string
+	var writer exportWriter
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		writer = newCSVExportWriter(c.Writer, includeBrokenLinks)
+	case "json":
+		contentType = "application/json"
+		writer = &jsonExportWriter{w: c.Writer}
+	case "ndjson":
+		contentType = "application/x-ndjson"
+		writer = &ndjsonExportWriter{enc: json.NewEncoder(c.Writer)}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv, json or ndjson"})
+		return
+	}
+
+	query, sortField, sortDirection := h.urlListQuery(c)
+
+	filename := fmt.Sprintf("urls-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// Headers are sent by now, so errors can only end the stream early
+	var last *models.URL
+	for {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+
+		// Each batch continues after the last row written rather than at an
+		// offset, so URLs added or deleted meanwhile don't shift the batches
+		batch := query.Session(&gorm.Session{}).Order(sortField + " " + sortDirection).Order("id")
+		if last != nil {
+			batch = exportAfter(batch, sortField, sortDirection, *last)
+		}
+		var urls []models.URL
+		if err := batch.Limit(exportBatchSize).Find(&urls).Error; err != nil {
+			logging.FromContext(c.Request.Context()).Error("URL export failed", "error", err)
+			return
+		}
+
+		records, err := h.buildExportRecords(c.Request.Context(), urls, includeBrokenLinks)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("URL export failed", "error", err)
+			return
+		}
+		for _, record := range records {
+			if err := writer.Write(record); err != nil {
+				return
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return
+		}
+		c.Writer.Flush()
+
+		if len(urls) < exportBatchSize {
+			break
+		}
+		last = &urls[len(urls)-1]
+	}
+
+	if err := writer.Close(); err == nil {
+		c.Writer.Flush()
+	}
+}
+
+// exportAfter limits query to the rows after last in the export's order: by
+// the sort field, then by ID.
+func exportAfter(query *gorm.DB, sortField, sortDirection string, last models.URL) *gorm.DB {
+	var value interface{}
+	switch sortField {
+	case "url":
+		value = last.URL
+	case "status":
+		value = last.Status
+	default:
+		value = last.CreatedAt
+	}
+	op := ">"
+	if sortDirection == "desc" {
+		op = "<"
+	}
+	return query.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id > ?))", sortField, op, sortField), value, value, last.ID)
+}
+
+// buildExportRecords joins one batch of URLs with their latest analyses and,
+// optionally, the broken links found anywhere in those analysis runs.
+func (h *URLHandler) buildExportRecords(ctx context.Context, urls []models.URL, includeBrokenLinks bool) ([]models.URLExport, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	urlIDs := make([]uint, len(urls))
+	for i, url := range urls {
+		urlIDs[i] = url.ID
+	}
+
+	// Versions grow with IDs, so the newest top-level row is the latest run
+	var latest []models.AnalysisResult
+	err := h.db.WithContext(ctx).Where("id IN (?)", h.db.Model(&models.AnalysisResult{}).
+		Select("MAX(id)").
+		Where("url_id IN ? AND parent_id IS NULL", urlIDs).
+		Group("url_id")).
+		Find(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+	byURL := make(map[uint]models.AnalysisResult, len(latest))
+	for _, result := range latest {
+		byURL[result.URLID] = result
+	}
+
+	linksByRun := make(map[uint][]models.BrokenLink)
+	if includeBrokenLinks && len(latest) > 0 {
+		runIDs := make([]uint, len(latest))
+		for i, result := range latest {
+			runIDs[i] = result.ID
+		}
+
+		// Site crawls keep their broken links on the per-page results
+		var pages []models.AnalysisResult
+		if err := h.db.WithContext(ctx).Select("id", "parent_id").Where("parent_id IN ?", runIDs).Find(&pages).Error; err != nil {
+			return nil, err
+		}
+		runOf := make(map[uint]uint, len(runIDs)+len(pages))
+		analysisIDs := append([]uint{}, runIDs...)
+		for _, id := range runIDs {
+			runOf[id] = id
+		}
+		for _, page := range pages {
+			runOf[page.ID] = *page.ParentID
+			analysisIDs = append(analysisIDs, page.ID)
+		}
+
+		var links []models.BrokenLink
+		if err := h.db.WithContext(ctx).Where("analysis_id IN ?", analysisIDs).Order("id").Find(&links).Error; err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			run := runOf[link.AnalysisID]
+			linksByRun[run] = append(linksByRun[run], link)
+		}
+	}
+
+	records := make([]models.URLExport, len(urls))
+	for i, url := range urls {
+		records[i] = models.URLExport{
+			ID:        url.ID,
+			URL:       url.URL,
+			Status:    url.Status,
+			CrawlMode: url.CrawlMode,
+			CreatedAt: url.CreatedAt,
+			UpdatedAt: url.UpdatedAt,
+		}
+		if result, ok := byURL[url.ID]; ok {
+			records[i].Analysis = models.NewAnalysisSummary(result)
+			if includeBrokenLinks {
+				records[i].BrokenLinks = linksByRun[result.ID]
+			}
+		}
+	}
+	return records, nil
+}
+
+type jsonExportWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (j *jsonExportWriter) Write(record models.URLExport) error {
+	prefix := ","
+	if !j.started {
+		prefix = "["
+		j.started = true
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, prefix); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonExportWriter) Flush() error { return nil }
+
+func (j *jsonExportWriter) Close() error {
+	closing := "]\n"
+	if !j.started {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
+
+type ndjsonExportWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonExportWriter) Write(record models.URLExport) error { return n.enc.Encode(record) }
+func (n *ndjsonExportWriter) Flush() error                        { return nil }
+func (n *ndjsonExportWriter) Close() error                        { return nil }
+
+// csvExportWriter writes one row per URL, or with broken links included, one
+// row per broken link with the URL columns repeated.
+type csvExportWriter struct {
+	w                  *csv.Writer
+	includeBrokenLinks bool
+	wroteHeader        bool
+}
+
+var csvExportColumns = []string{
+	"id", "url", "status", "crawl_mode", "created_at", "updated_at",
+	"analysis_id", "version", "analyzed_at", "title", "html_version",
+	"h1_count", "h2_count", "h3_count", "h4_count", "h5_count", "h6_count",
+	"pages_crawled", "internal_links", "external_links", "broken_links", "disallowed_links", "has_login_form",
+}
+
+var csvBrokenLinkColumns = []string{"link_url", "link_status_code", "link_error", "link_outcome"}
+
+func newCSVExportWriter(w io.Writer, includeBrokenLinks bool) *csvExportWriter {
+	return &csvExportWriter{w: csv.NewWriter(w), includeBrokenLinks: includeBrokenLinks}
+}
+
+func (cw *csvExportWriter) Write(record models.URLExport) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+
+	row := []string{
+		strconv.FormatUint(uint64(record.ID), 10),
+		csvText(record.URL),
+		record.Status,
+		record.CrawlMode,
+		record.CreatedAt.UTC().Format(time.RFC3339),
+		record.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if a := record.Analysis; a != nil {
+		row = append(row,
+			strconv.FormatUint(uint64(a.ID), 10),
+			strconv.Itoa(a.Version),
+			a.CreatedAt.UTC().Format(time.RFC3339),
+			csvText(a.Title),
+			csvText(a.HTMLVersion),
+			strconv.Itoa(a.H1Count),
+			strconv.Itoa(a.H2Count),
+			strconv.Itoa(a.H3Count),
+			strconv.Itoa(a.H4Count),
+			strconv.Itoa(a.H5Count),
+			strconv.Itoa(a.H6Count),
+			strconv.Itoa(a.PagesCrawled),
+			strconv.Itoa(a.InternalLinks),
+			strconv.Itoa(a.ExternalLinks),
+			strconv.Itoa(a.BrokenLinks),
+			strconv.Itoa(a.DisallowedLinks),
+			strconv.FormatBool(a.HasLoginForm),
+		)
+	} else {
+		row = append(row, make([]string, len(csvExportColumns)-len(row))...)
+	}
+
+	if !cw.includeBrokenLinks {
+		return cw.w.Write(row)
+	}
+	if len(record.BrokenLinks) == 0 {
+		return cw.w.Write(append(row, make([]string, len(csvBrokenLinkColumns))...))
+	}
+	for _, link := range record.BrokenLinks {
+		linkRow := append(append([]string{}, row...),
+			csvText(link.URL),
+			strconv.Itoa(link.StatusCode),
+			csvText(link.ErrorMessage),
+			link.Outcome,
+		)
+		if err := cw.w.Write(linkRow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvText neutralizes text taken from crawled pages that spreadsheets would
+// otherwise run as a formula, by prefixing it with a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (cw *csvExportWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Close makes sure even an empty export has a header row.
+func (cw *csvExportWriter) Close() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	return cw.Flush()
+}
+
+func (cw *csvExportWriter) writeHeader() error {
+	if cw.wroteHeader {
+		return nil
+	}
+	cw.wroteHeader = true
+
+	header := csvExportColumns
+	if cw.includeBrokenLinks {
+		header = append(append([]string{}, header...), csvBrokenLinkColumns...)
+	}
+	return cw.w.Write(header)
+}
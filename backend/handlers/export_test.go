@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// exportTestURLs is enough URLs for the export to take two batches
+const exportTestURLs = exportBatchSize + 1
+
+// newTestDB opens a fresh SQLite database holding the given models. It is
+// closed when the test ends.
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// setupExport returns a fresh database with exportTestURLs URLs in workspace
+// 1, every third one done, and one in workspace 2. Pairs of URLs share a
+// creation time. The first URL has an analysis with two broken links.
+func setupExport(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db := newTestDB(t, &models.URL{}, &models.AnalysisResult{}, &models.BrokenLink{})
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	urls := make([]models.URL, 0, exportTestURLs+1)
+	for i := 0; i < exportTestURLs; i++ {
+		status := models.StatusQueued
+		if i%3 == 0 {
+			status = models.StatusDone
+		}
+		urls = append(urls, models.URL{
+			WorkspaceID: 1,
+			URL:         fmt.Sprintf("https://example.com/page-%04d", i),
+			Status:      string(status),
+			CreatedAt:   base.Add(time.Duration(i/2) * time.Second),
+		})
+	}
+	urls = append(urls, models.URL{WorkspaceID: 2, URL: "https://other.example", Status: string(models.StatusDone)})
+	if err := db.CreateInBatches(&urls, 100).Error; err != nil {
+		t.Fatalf("Failed to create URLs: %v", err)
+	}
+
+	result := models.AnalysisResult{URLID: urls[0].ID, Version: 1, Title: "Page 0", BrokenLinks: 2}
+	db.Create(&result)
+	db.Create(&[]models.BrokenLink{
+		{AnalysisID: result.ID, URL: "https://example.com/gone", StatusCode: 404, Outcome: "broken"},
+		{AnalysisID: result.ID, URL: "https://example.com/down", StatusCode: 500, Outcome: "broken"},
+	})
+	return db
+}
+
+// export runs ExportURLs for workspace 1 with the query string
+func export(t *testing.T, db *gorm.DB, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/urls/export", func(c *gin.Context) {
+		c.Set(utils.ContextAPIKey, &models.APIKey{WorkspaceID: 1})
+	}, NewURLHandler(db, nil, nil).ExportURLs)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/urls/export?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	return w
+}
+
+func TestExportURLsCSV(t *testing.T) {
+	db := setupExport(t)
+
+	w := export(t, db, "format=csv&include=broken_links&sort_field=url&sort_direction=asc")
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows[0]) != len(csvExportColumns)+len(csvBrokenLinkColumns) || rows[0][0] != "id" {
+		t.Errorf("header = %v", rows[0])
+	}
+	// One row per URL, and a second one for the first URL's other broken link
+	if got, want := len(rows)-1, exportTestURLs+1; got != want {
+		t.Fatalf("rows = %d, want %d", got, want)
+	}
+	linkURL := len(csvExportColumns)
+	if rows[1][1] != "https://example.com/page-0000" || rows[1][linkURL] != "https://example.com/gone" || rows[2][linkURL] != "https://example.com/down" {
+		t.Errorf("first rows = %v, %v, want page-0000 with both broken links", rows[1], rows[2])
+	}
+	if last := rows[len(rows)-1]; last[1] != fmt.Sprintf("https://example.com/page-%04d", exportTestURLs-1) {
+		t.Errorf("last row = %v, want the last URL", last)
+	}
+}
+
+func TestExportURLsCSVEscapesFormulas(t *testing.T) {
+	db := setupExport(t)
+	db.Model(&models.AnalysisResult{}).Where("title = ?", "Page 0").Update("title", `=HYPERLINK("https://evil.example")`)
+	db.Model(&models.BrokenLink{}).Where("url = ?", "https://example.com/gone").Update("error_message", "@SUM(1+1)")
+
+	w := export(t, db, "format=csv&include=broken_links&sort_field=url&sort_direction=asc")
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	title := slices.Index(csvExportColumns, "title")
+	linkError := len(csvExportColumns) + slices.Index(csvBrokenLinkColumns, "link_error")
+	if got := rows[1][title]; got != `'=HYPERLINK("https://evil.example")` {
+		t.Errorf("title = %q, want it quoted", got)
+	}
+	if got := rows[1][linkError]; got != "'@SUM(1+1)" {
+		t.Errorf("link_error = %q, want it quoted", got)
+	}
+	if got := rows[1][1]; got != "https://example.com/page-0000" {
+		t.Errorf("url = %q, want it unchanged", got)
+	}
+}
+
+func TestExportURLsJSON(t *testing.T) {
+	db := setupExport(t)
+
+	w := export(t, db, "format=json")
+
+	var records []models.URLExport
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(records) != exportTestURLs {
+		t.Fatalf("records = %d, want %d", len(records), exportTestURLs)
+	}
+	// Newest first by default, with URLs created at the same time by ID, so
+	// the batches neither skip nor repeat rows sharing a creation time
+	for i := 1; i < len(records); i++ {
+		prev, cur := records[i-1], records[i]
+		if cur.CreatedAt.After(prev.CreatedAt) || (cur.CreatedAt.Equal(prev.CreatedAt) && cur.ID <= prev.ID) {
+			t.Fatalf("record %d (%d, %s) is out of order after %d (%s)", i, cur.ID, cur.CreatedAt, prev.ID, prev.CreatedAt)
+		}
+	}
+	if first := records[len(records)-2]; first.URL != "https://example.com/page-0000" || first.Analysis == nil ||
+		first.Analysis.Title != "Page 0" || first.BrokenLinks != nil {
+		t.Errorf("first URL's record = %+v, want its analysis without broken links", first)
+	}
+}
+
+func TestExportURLsNDJSON(t *testing.T) {
+	db := setupExport(t)
+
+	w := export(t, db, "format=ndjson&status=done")
+
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var record models.URLExport
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d: %v", lines+1, err)
+		}
+		if record.Status != string(models.StatusDone) {
+			t.Errorf("record %d has status %q, want only done URLs", record.ID, record.Status)
+		}
+		lines++
+	}
+	if want := (exportTestURLs + 2) / 3; lines != want {
+		t.Errorf("lines = %d, want %d", lines, want)
+	}
+}
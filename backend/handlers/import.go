@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+)
+
+const (
+	// importBatchSize bounds the size of the IN lists and inserts used by bulk imports
+	importBatchSize = 500
+	// maxImportFileSize caps uploaded URL lists
+	maxImportFileSize = 10 << 20
+	// sitemapImportTimeout bounds fetching a sitemap and all its children
+	sitemapImportTimeout = 30 * time.Second
+)
+
+// ImportSitemap handles POST /api/urls/sitemap
+func (h *URLHandler) ImportSitemap(c *gin.Context) {
+	var req models.SitemapImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), sitemapImportTimeout)
+	defer cancel()
+	entries, err := h.crawler.FetchSitemap(ctx, req.URL)
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Sitemap took too long to fetch"})
+		return
+	}
+	if errors.Is(err, utils.ErrNotSitemap) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.SitemapImportResponse{Found: len(entries)}
+	var candidates []string
+	for _, entry := range entries {
+		normalized, err := utils.NormalizeURL(entry)
+		if err != nil {
+			response.Invalid++
+			continue
+		}
+		candidates = append(candidates, normalized)
+	}
+
+	added, ok := h.importURLs(c, candidates)
+	if !ok {
+		return
+	}
+	response.Added = len(added)
+	response.Skipped = len(candidates) - len(added)
+
+	utils.RecordAudit(c, h.db, models.AuditURLSitemapImport, "url", sortedIDs(added), gin.H{"sitemap": req.URL, "found": response.Found})
+	c.JSON(http.StatusOK, response)
+}
+
+// ImportURLs handles POST /api/urls/import
+// It takes a multipart "file" holding a CSV or newline-delimited list of URLs
+// and reports the outcome of every entry.
+func (h *URLHandler) ImportURLs(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file field with the URL list is required"})
+		return
+	}
+	if header.Size > maxImportFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File is larger than %d MB", maxImportFileSize>>20)})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	parse := utils.ParseURLList
+	if isCSVUpload(c.PostForm("format"), header.Filename, header.Header.Get("Content-Type")) {
+		parse = utils.ParseURLCSV
+	}
+	entries, err := parse(io.LimitReader(file, maxImportFileSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.BulkImportResponse{
+		Total: len(entries),
+		Lines: make([]models.ImportLineResult, len(entries)),
+	}
+	var candidates []string
+	firstLine := make(map[string]int)
+	for i, entry := range entries {
+		result := models.ImportLineResult{Line: entry.Line, URL: entry.Value}
+
+		normalized, err := validateImportURL(entry.Value)
+		switch {
+		case err != nil:
+			result.Status, result.Reason = models.ImportRejected, err.Error()
+		case firstLine[normalized] > 0:
+			result.Status, result.Reason = models.ImportDuplicate, fmt.Sprintf("same URL as line %d", firstLine[normalized])
+		default:
+			firstLine[normalized] = entry.Line
+			result.URL = normalized
+			candidates = append(candidates, normalized)
+		}
+		response.Lines[i] = result
+	}
+
+	added, ok := h.importURLs(c, candidates)
+	if !ok {
+		return
+	}
+
+	for i := range response.Lines {
+		line := &response.Lines[i]
+		if line.Status == "" {
+			if added[line.URL] != 0 {
+				line.Status = models.ImportAccepted
+			} else {
+				line.Status, line.Reason = models.ImportDuplicate, "URL already exists"
+			}
+		}
+		switch line.Status {
+		case models.ImportAccepted:
+			response.Accepted++
+		case models.ImportDuplicate:
+			response.Duplicates++
+		case models.ImportRejected:
+			response.Rejected++
+		}
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditURLImport, "url", sortedIDs(added), gin.H{"filename": header.Filename, "total": response.Total})
+	c.JSON(http.StatusOK, response)
+}
+
+// validateImportURL applies the same rules as CreateURLRequest to one entry
+// and returns its normalized form.
+func validateImportURL(raw string) (string, error) {
+	if err := binding.Validator.ValidateStruct(&models.CreateURLRequest{URL: raw}); err != nil {
+		return "", errors.New("invalid URL format")
+	}
+	return utils.NormalizeURL(raw)
+}
+
+// isCSVUpload decides between CSV and plain text from an explicit format
+// field, then the file extension, then the part's content type.
+func isCSVUpload(format, filename, contentType string) bool {
+	switch strings.ToLower(format) {
+	case "csv":
+		return true
+	case "text", "txt":
+		return false
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		return true
+	}
+	return strings.HasPrefix(contentType, "text/csv") || strings.HasPrefix(contentType, "application/csv")
+}
+
+// importURLs adds the candidates that are new to the request's workspace,
+// reserving analysis quota for them only. It returns the IDs of the URLs it
+// created, keyed by URL, or writes an error response and returns false.
+func (h *URLHandler) importURLs(c *gin.Context, candidates []string) (map[string]uint, bool) {
+	ctx := c.Request.Context()
+	workspaceID := utils.CurrentWorkspaceID(c)
+
+	fresh, err := h.newURLs(ctx, workspaceID, candidates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import URLs"})
+		return nil, false
+	}
+	if !h.reserveAnalyses(c, len(fresh)) {
+		return nil, false
+	}
+	// URLs added concurrently since the check are skipped; give their quota back
+	added, err := h.addURLs(ctx, workspaceID, fresh)
+	h.releaseAnalyses(c, len(fresh)-len(added))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import URLs"})
+		return nil, false
+	}
+	return added, true
+}
+
+// newURLs returns the candidates that are not in the workspace yet, each once.
+func (h *URLHandler) newURLs(ctx context.Context, workspaceID uint, candidates []string) ([]string, error) {
+	unique := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		if !seen[candidate] {
+			seen[candidate] = true
+			unique = append(unique, candidate)
+		}
+	}
+
+	fresh := make([]string, 0, len(unique))
+	for start := 0; start < len(unique); start += importBatchSize {
+		chunk := unique[start:min(start+importBatchSize, len(unique))]
+
+		var existing []string
+		if err := h.db.WithContext(ctx).Model(&models.URL{}).
+			Where("workspace_id = ? AND url IN ?", workspaceID, chunk).Pluck("url", &existing).Error; err != nil {
+			return nil, err
+		}
+		exists := make(map[string]bool, len(existing))
+		for _, url := range existing {
+			exists[url] = true
+		}
+		for _, candidate := range chunk {
+			if !exists[candidate] {
+				fresh = append(fresh, candidate)
+			}
+		}
+	}
+	return fresh, nil
+}
+
+// addURLs creates and enqueues the given new, normalized URLs in a workspace,
+// skipping any that were added concurrently. It returns the IDs of the URLs
+// it created, keyed by URL.
+func (h *URLHandler) addURLs(ctx context.Context, workspaceID uint, fresh []string) (map[string]uint, error) {
+	added := make(map[string]uint)
+	for start := 0; start < len(fresh); start += importBatchSize {
+		chunk := fresh[start:min(start+importBatchSize, len(fresh))]
+
+		urls := make([]models.URL, len(chunk))
+		for i, candidate := range chunk {
+			urls[i] = models.URL{
+				WorkspaceID: workspaceID,
+				URL:         candidate,
+				Status:      string(models.StatusQueued),
+				CrawlMode:   string(models.CrawlModePage),
+			}
+		}
+
+		var insertErr error
+		if err := h.db.WithContext(ctx).Create(&urls).Error; err != nil {
+			// Possibly a concurrent insert of one of these URLs; fall back to one
+			// row at a time so only the conflicting rows are skipped. Any other
+			// error stops the import once the rows created so far are queued.
+			var created []models.URL
+			for _, url := range urls {
+				url.ID = 0
+				err := h.db.WithContext(ctx).Create(&url).Error
+				if err == nil {
+					created = append(created, url)
+				} else if !utils.IsDuplicateKey(err) {
+					insertErr = err
+					break
+				}
+			}
+			urls = created
+		}
+
+		ids := make([]uint, 0, len(urls))
+		for _, url := range urls {
+			ids = append(ids, url.ID)
+			added[url.URL] = url.ID
+		}
+		if err := h.queue.EnqueueBatch(ctx, ids); err != nil {
+			return added, err
+		}
+		if insertErr != nil {
+			return added, insertErr
+		}
+	}
+	return added, nil
+}
+
+// sortedIDs returns the IDs of the URLs added by addURLs in ascending order.
+func sortedIDs(added map[string]uint) []uint {
+	ids := make([]uint, 0, len(added))
+	for _, id := range added {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
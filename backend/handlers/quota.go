@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/utils"
+)
+
+// reserveAnalyses counts n analyses against the caller's daily quotas and
+// sets the X-RateLimit-Analyses-* headers. When the quota is exhausted it
+// writes a 429 response and returns false.
+func (h *URLHandler) reserveAnalyses(c *gin.Context, n int) bool {
+	key := utils.CurrentAPIKey(c)
+	if key == nil || n <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	status, err := utils.ReserveAnalyses(h.db.WithContext(c.Request.Context()), key, n, now)
+	if err != nil {
+		// Quota bookkeeping failing should not take the API down with it
+		logging.FromContext(c.Request.Context()).Error("Failed to check analysis quota", "error", err)
+		return true
+	}
+
+	resetIn := int(math.Ceil(status.Reset.Sub(now).Seconds()))
+	if status.Limit > 0 {
+		c.Header("X-RateLimit-Analyses-Limit", strconv.Itoa(status.Limit))
+		c.Header("X-RateLimit-Analyses-Remaining", strconv.Itoa(status.Remaining))
+		c.Header("X-RateLimit-Analyses-Reset", strconv.Itoa(resetIn))
+	}
+	if !status.Allowed {
+		c.Header("Retry-After", strconv.Itoa(resetIn))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":     "Daily analysis quota exceeded",
+			"limit":     status.Limit,
+			"remaining": status.Remaining,
+			"requested": n,
+		})
+		return false
+	}
+	return true
+}
+
+// releaseAnalyses returns reserved analyses that ended up not being queued.
+func (h *URLHandler) releaseAnalyses(c *gin.Context, n int) {
+	key := utils.CurrentAPIKey(c)
+	if key == nil || n <= 0 {
+		return
+	}
+	if err := utils.ReleaseAnalyses(h.db.WithContext(c.Request.Context()), key, n, time.Now()); err != nil {
+		logging.FromContext(c.Request.Context()).Error("Failed to release analysis quota", "error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+)
+
+// SetSchedule handles PUT /api/urls/:id/schedule
+func (h *URLHandler) SetSchedule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	var req models.SetScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	schedule, err := utils.ParseSchedule(req.Schedule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var url models.URL
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	url.Schedule = strings.TrimSpace(req.Schedule)
+	next := schedule.Next(time.Now().UTC())
+	url.NextRunAt = &next
+	if err := h.db.WithContext(c.Request.Context()).Model(&url).Select("schedule", "next_run_at").Updates(&url).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save schedule"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditScheduleSet, "url", []uint{url.ID}, gin.H{"schedule": url.Schedule})
+	c.JSON(http.StatusOK, url)
+}
+
+// ClearSchedule handles DELETE /api/urls/:id/schedule
+func (h *URLHandler) ClearSchedule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	var url models.URL
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	url.Schedule = ""
+	url.NextRunAt = nil
+	if err := h.db.WithContext(c.Request.Context()).Model(&url).Select("schedule", "next_run_at").Updates(&url).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear schedule"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditScheduleClear, "url", []uint{url.ID}, nil)
+	c.JSON(http.StatusOK, url)
+}
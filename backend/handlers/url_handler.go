@@ -1,22 +1,29 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sykell/backend/config"
+	"github.com/sykell/backend/jobs"
 	"github.com/sykell/backend/models"
 	"github.com/sykell/backend/utils"
+	"gorm.io/gorm"
 )
 
 type URLHandler struct {
+	db      *gorm.DB
+	queue   *jobs.Queue
 	crawler *utils.CrawlerService
 }
 
-func NewURLHandler() *URLHandler {
+func NewURLHandler(db *gorm.DB, queue *jobs.Queue, crawler *utils.CrawlerService) *URLHandler {
 	return &URLHandler{
-		crawler: utils.NewCrawlerService(),
+		db:      db,
+		queue:   queue,
+		crawler: crawler,
 	}
 }
 
@@ -28,76 +35,73 @@ func (h *URLHandler) CreateURL(c *gin.Context) {
 		return
 	}
 
-	// Check if URL already exists
+	// Store the same canonical form as imports so they recognize each other
+	normalized, err := utils.NormalizeURL(req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check if URL already exists in this workspace
 	var existingURL models.URL
-	if err := config.DB.Where("url = ?", req.URL).First(&existingURL).Error; err == nil {
+	if err := h.workspaceURLs(c).Where("url = ?", normalized).First(&existingURL).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "URL already exists"})
 		return
 	}
 
 	// Create new URL
 	url := models.URL{
-		URL:    req.URL,
-		Status: string(models.StatusQueued),
+		WorkspaceID:  utils.CurrentWorkspaceID(c),
+		URL:          normalized,
+		Status:       string(models.StatusQueued),
+		CrawlMode:    string(models.CrawlModePage),
+		IgnoreRobots: req.IgnoreRobots,
+	}
+	if req.CrawlMode == string(models.CrawlModeSite) {
+		url.CrawlMode = req.CrawlMode
+		url.MaxDepth = req.MaxDepth
+		url.MaxPages = req.MaxPages
+		if url.MaxDepth == 0 {
+			url.MaxDepth = utils.DefaultCrawlDepth
+		}
+		if url.MaxPages == 0 {
+			url.MaxPages = utils.DefaultCrawlPages
+		}
 	}
 
-	if err := config.DB.Create(&url).Error; err != nil {
+	if !h.reserveAnalyses(c, 1) {
+		return
+	}
+	// Insert the URL and queue its analysis for the worker pool together
+	if _, err := h.queue.CreateAndEnqueue(c.Request.Context(), &url); err != nil {
+		h.releaseAnalyses(c, 1)
+		if utils.IsDuplicateKey(err) {
+			// Added concurrently since the check above
+			c.JSON(http.StatusConflict, gin.H{"error": "URL already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create URL"})
 		return
 	}
 
-	// Start analysis in background
-	go h.analyzeURL(url.ID, req.URL)
-
+	utils.RecordAudit(c, h.db, models.AuditURLCreate, "url", []uint{url.ID}, gin.H{"url": url.URL, "crawl_mode": url.CrawlMode})
 	c.JSON(http.StatusCreated, url)
 }
 
 // GetURLs handles GET /api/urls
 func (h *URLHandler) GetURLs(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	search := c.Query("search")
-	status := c.Query("status")
-	sortField := c.DefaultQuery("sort_field", "created_at")
-	sortDirection := c.DefaultQuery("sort_direction", "desc")
-
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
-	}
-
+	page, pageSize := parsePagination(c)
 	offset := (page - 1) * pageSize
 
 	var urls []models.URL
 	var total int64
 
-	query := config.DB.Model(&models.URL{})
-
-	// Apply search filter
-	if search != "" {
-		query = query.Where("url LIKE ?", "%"+search+"%")
-	}
-
-	// Apply status filter
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
+	query, sortField, sortDirection := h.urlListQuery(c)
+	orderClause := sortField + " " + sortDirection
 
 	// Get total count
 	query.Count(&total)
 
-	// Validate sort field and direction
-	allowedFields := map[string]bool{"created_at": true, "url": true, "status": true}
-	if !allowedFields[sortField] {
-		sortField = "created_at"
-	}
-	if sortDirection != "asc" && sortDirection != "desc" {
-		sortDirection = "desc"
-	}
-	orderClause := sortField + " " + sortDirection
-
 	// Get paginated results
 	err := query.Offset(offset).Limit(pageSize).Order(orderClause).Find(&urls).Error
 	if err != nil {
@@ -118,7 +122,8 @@ func (h *URLHandler) GetURLs(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// GetURLDetails handles GET /api/urls/:id
+// GetURLDetails handles GET /api/urls/:id and GET /api/urls/:id/analyses/:analysis_id.
+// Without an analysis ID it returns the latest analysis run.
 func (h *URLHandler) GetURLDetails(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -127,22 +132,32 @@ func (h *URLHandler) GetURLDetails(c *gin.Context) {
 	}
 
 	var url models.URL
-	if err := config.DB.First(&url, id).Error; err != nil {
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
 		return
 	}
 
 	var analysis models.AnalysisResult
-	var brokenLinks []models.BrokenLink
-	
-	if err := config.DB.Where("url_id = ?", id).First(&analysis).Error; err != nil {
+
+	query := h.db.WithContext(c.Request.Context()).Where("url_id = ? AND parent_id IS NULL", id)
+	if param := c.Param("analysis_id"); param != "" {
+		analysisID, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid analysis ID"})
+			return
+		}
+		if err := query.Where("id = ?", analysisID).First(&analysis).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+			return
+		}
+	} else if err := query.Order("version desc").First(&analysis).Error; err != nil {
 		// No analysis found, return empty analysis result
 		response := models.AnalysisDetailResponse{
 			AnalysisResult: models.AnalysisResult{
 				URLID: url.ID,
 				URL:   url,
 			},
-			BrokenLinks: brokenLinks,
+			BrokenLinks: []models.BrokenLink{},
 		}
 		c.JSON(http.StatusOK, response)
 		return
@@ -150,16 +165,144 @@ func (h *URLHandler) GetURLDetails(c *gin.Context) {
 
 	// Analysis found, populate the URL field and get broken links
 	analysis.URL = url
-	config.DB.Where("analysis_id = ?", analysis.ID).Find(&brokenLinks)
+
+	pages, brokenLinks := h.loadRunDetails(c.Request.Context(), analysis.ID)
 
 	response := models.AnalysisDetailResponse{
 		AnalysisResult: analysis,
 		BrokenLinks:    brokenLinks,
+		Pages:          pages,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// GetAnalysisHistory handles GET /api/urls/:id/analyses
+func (h *URLHandler) GetAnalysisHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	var url models.URL
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+
+	var analyses []models.AnalysisResult
+	var total int64
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.AnalysisResult{}).Where("url_id = ? AND parent_id IS NULL", id)
+	query.Count(&total)
+
+	err = query.Order("version desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&analyses).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analyses"})
+		return
+	}
+
+	response := models.AnalysisHistoryResponse{
+		Analyses:   analyses,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DiffAnalyses handles GET /api/urls/:id/analyses/diff?from=&to=
+// Both IDs are optional and default to the two most recent runs.
+func (h *URLHandler) DiffAnalyses(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	var url models.URL
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	var latest []models.AnalysisResult
+	h.db.WithContext(c.Request.Context()).Where("url_id = ? AND parent_id IS NULL", id).Order("version desc").Limit(2).Find(&latest)
+
+	var from, to models.AnalysisResult
+	for _, side := range []struct {
+		param    string
+		fallback int
+		target   *models.AnalysisResult
+	}{
+		{"to", 0, &to},
+		{"from", 1, &from},
+	} {
+		raw := c.Query(side.param)
+		if raw == "" {
+			if len(latest) <= side.fallback {
+				c.JSON(http.StatusNotFound, gin.H{"error": "At least two analyses are needed to compare"})
+				return
+			}
+			*side.target = latest[side.fallback]
+			continue
+		}
+
+		analysisID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid analysis ID for " + side.param})
+			return
+		}
+		if err := h.db.WithContext(c.Request.Context()).Where("url_id = ? AND parent_id IS NULL", id).First(side.target, analysisID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis " + raw + " not found"})
+			return
+		}
+	}
+
+	fromPages, fromLinks := h.loadRunDetails(c.Request.Context(), from.ID)
+	toPages, toLinks := h.loadRunDetails(c.Request.Context(), to.ID)
+	from.CheckedLinks = runCheckedLinks(from, fromPages)
+	to.CheckedLinks = runCheckedLinks(to, toPages)
+
+	c.JSON(http.StatusOK, utils.DiffAnalyses(from, to, fromLinks, toLinks))
+}
+
+// UpdateURL handles PATCH /api/urls/:id
+// Only ignore_robots can be changed; it applies from the next analysis.
+func (h *URLHandler) UpdateURL(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	var req models.UpdateURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var url models.URL
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	url.IgnoreRobots = *req.IgnoreRobots
+	if err := h.db.WithContext(c.Request.Context()).Model(&url).Select("ignore_robots").Updates(&url).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update URL"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditURLUpdate, "url", []uint{url.ID}, gin.H{"ignore_robots": url.IgnoreRobots})
+	c.JSON(http.StatusOK, url)
+}
+
 // DeleteURLs handles DELETE /api/urls
 func (h *URLHandler) DeleteURLs(c *gin.Context) {
 	var req struct {
@@ -171,15 +314,53 @@ func (h *URLHandler) DeleteURLs(c *gin.Context) {
 		return
 	}
 
-	// Delete analysis results first
-	config.DB.Where("url_id IN ?", req.IDs).Delete(&models.AnalysisResult{})
+	// IDs from other workspaces are ignored
+	var ids []uint
+	if err := h.workspaceURLs(c).Where("id IN ?", req.IDs).Pluck("id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete URLs"})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "URLs deleted successfully"})
+		return
+	}
+
+	// Stop active analyses first, so their workers don't save results for
+	// URLs that are gone
+	db := h.db.WithContext(c.Request.Context())
+	var active []uint
+	if err := db.Model(&models.AnalysisJob{}).Where("url_id IN ? AND status IN ?", ids, models.ActiveJobStatuses).
+		Distinct().Pluck("url_id", &active).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete URLs"})
+		return
+	}
+	for _, urlID := range active {
+		if _, err := h.queue.Cancel(urlID); err != nil && !errors.Is(err, jobs.ErrNoActiveJob) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete URLs"})
+			return
+		}
+	}
 
-	// Delete URLs
-	if err := config.DB.Where("id IN ?", req.IDs).Delete(&models.URL{}).Error; err != nil {
+	// Delete the jobs, the whole analysis history and the URLs together
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("url_id IN ?", ids).Delete(&models.AnalysisJob{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("analysis_id IN (?)", h.db.Model(&models.AnalysisResult{}).Select("id").Where("url_id IN ?", ids)).
+			Delete(&models.BrokenLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("url_id IN ?", ids).Delete(&models.AnalysisResult{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.URL{}).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete URLs"})
 		return
 	}
 
+	utils.RecordAudit(c, h.db, models.AuditURLDelete, "url", ids, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "URLs deleted successfully"})
 }
 
@@ -192,58 +373,138 @@ func (h *URLHandler) ReanalyzeURL(c *gin.Context) {
 	}
 
 	var url models.URL
-	if err := config.DB.First(&url, id).Error; err != nil {
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
 		return
 	}
 
-	// Update status to queued
-	url.Status = string(models.StatusQueued)
-	config.DB.Save(&url)
+	// Asking again while an analysis is pending returns that analysis, which
+	// is not counted against the quota a second time
+	var active int64
+	h.db.WithContext(c.Request.Context()).Model(&models.AnalysisJob{}).Where("url_id = ? AND status IN ?", url.ID, models.ActiveJobStatuses).Count(&active)
+	reserved := 0
+	if active == 0 {
+		if !h.reserveAnalyses(c, 1) {
+			return
+		}
+		reserved = 1
+	}
 
-	// Start analysis in background
-	go h.analyzeURL(url.ID, url.URL)
+	job, err := h.queue.Enqueue(c.Request.Context(), url.ID)
+	if err != nil {
+		h.releaseAnalyses(c, reserved)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue analysis"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Reanalysis started"})
+	utils.RecordAudit(c, h.db, models.AuditURLReanalyze, "url", []uint{url.ID}, gin.H{"job_id": job.ID})
+	c.JSON(http.StatusOK, gin.H{"message": "Reanalysis queued", "job": job})
 }
 
-// analyzeURL performs the actual URL analysis in background
-func (h *URLHandler) analyzeURL(urlID uint, targetURL string) {
-	db := config.DB
-
-	// Update status to running
-	db.Model(&models.URL{}).Where("id = ?", urlID).Update("status", models.StatusRunning)
+// CancelAnalysis handles POST /api/urls/:id/cancel
+func (h *URLHandler) CancelAnalysis(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
 
-	// Perform analysis
-	result, brokenLinks, err := h.crawler.AnalyzeURL(targetURL)
+	var url models.URL
+	if err := h.workspaceURLs(c).First(&url, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
 
+	job, err := h.queue.Cancel(url.ID)
+	if errors.Is(err, jobs.ErrNoActiveJob) {
+		c.JSON(http.StatusConflict, gin.H{"error": "No queued or running analysis to cancel"})
+		return
+	}
 	if err != nil {
-		// Update status to error
-		db.Model(&models.URL{}).Where("id = ?", urlID).Update("status", models.StatusError)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel analysis"})
 		return
 	}
 
-	// Set URL ID
-	result.URLID = urlID
+	utils.RecordAudit(c, h.db, models.AuditURLCancel, "url", []uint{url.ID}, gin.H{"job_id": job.ID})
+	c.JSON(http.StatusOK, gin.H{"message": "Analysis cancelled", "job": job})
+}
 
-	// Delete existing analysis if any
-	db.Where("url_id = ?", urlID).Delete(&models.AnalysisResult{})
-	db.Where("analysis_id IN (SELECT id FROM analysis_results WHERE url_id = ?)", urlID).Delete(&models.BrokenLink{})
+// workspaceURLs starts a URL query limited to the caller's workspace. Analyses,
+// jobs and broken links are only reached through a URL found this way.
+func (h *URLHandler) workspaceURLs(c *gin.Context) *gorm.DB {
+	return h.db.WithContext(c.Request.Context()).Model(&models.URL{}).Where("workspace_id = ?", utils.CurrentWorkspaceID(c))
+}
 
-	// Save analysis result
-	if err := db.Create(result).Error; err != nil {
-		db.Model(&models.URL{}).Where("id = ?", urlID).Update("status", models.StatusError)
-		return
+// urlListQuery applies the search and status filters of the URL list to a new
+// query and returns it with the validated sort field and direction.
+func (h *URLHandler) urlListQuery(c *gin.Context) (*gorm.DB, string, string) {
+	search := c.Query("search")
+	status := c.Query("status")
+	sortField := c.DefaultQuery("sort_field", "created_at")
+	sortDirection := c.DefaultQuery("sort_direction", "desc")
+
+	query := h.workspaceURLs(c)
+
+	// Apply search filter
+	if search != "" {
+		query = query.Where("url LIKE ?", "%"+search+"%")
+	}
+
+	// Apply status filter
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	// Validate sort field and direction
+	allowedFields := map[string]bool{"created_at": true, "url": true, "status": true}
+	if !allowedFields[sortField] {
+		sortField = "created_at"
+	}
+	if sortDirection != "asc" && sortDirection != "desc" {
+		sortDirection = "desc"
+	}
+	return query, sortField, sortDirection
+}
+
+// parsePagination reads the page and page_size query parameters, falling
+// back to the first page of 10 items.
+func parsePagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
 	}
+	return page, pageSize
+}
 
-	// Save broken links
-	for i := range brokenLinks {
-		brokenLinks[i].AnalysisID = result.ID
+// runCheckedLinks collects the links checked anywhere in a run. It is nil if
+// none of the run's results recorded them.
+func runCheckedLinks(run models.AnalysisResult, pages []models.AnalysisResult) []string {
+	links := run.CheckedLinks
+	for _, page := range pages {
+		if page.CheckedLinks != nil {
+			links = append(append([]string{}, links...), page.CheckedLinks...)
+		}
 	}
-	if len(brokenLinks) > 0 {
-		db.Create(&brokenLinks)
+	return links
+}
+
+// loadRunDetails returns the per-page results of an analysis run, which only
+// site crawls have, and the broken links found anywhere in the run.
+func (h *URLHandler) loadRunDetails(ctx context.Context, analysisID uint) ([]models.AnalysisResult, []models.BrokenLink) {
+	var pages []models.AnalysisResult
+	h.db.WithContext(ctx).Where("parent_id = ?", analysisID).Order("depth, id").Find(&pages)
+
+	analysisIDs := []uint{analysisID}
+	for _, page := range pages {
+		analysisIDs = append(analysisIDs, page.ID)
 	}
 
-	// Update status to done
-	db.Model(&models.URL{}).Where("id = ?", urlID).Update("status", models.StatusDone)
-} 
\ No newline at end of file
+	brokenLinks := []models.BrokenLink{}
+	h.db.WithContext(ctx).Where("analysis_id IN ?", analysisIDs).Find(&brokenLinks)
+	return pages, brokenLinks
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+	"github.com/sykell/backend/webhooks"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	db         *gorm.DB
+	dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhookHandler(db *gorm.DB, dispatcher *webhooks.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{db: db, dispatcher: dispatcher}
+}
+
+// CreateWebhook handles POST /api/webhooks
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	webhook := models.Webhook{
+		WorkspaceID: utils.CurrentWorkspaceID(c),
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      strings.Join(req.Events, ","),
+		Active:      true,
+	}
+	if err := h.db.WithContext(c.Request.Context()).Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditWebhookCreate, "webhook", []uint{webhook.ID}, gin.H{"url": webhook.URL, "events": webhook.Events})
+
+	// The secret is shown this once
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// GetWebhooks handles GET /api/webhooks
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	var hooks []models.Webhook
+	if err := h.db.WithContext(c.Request.Context()).Where("workspace_id = ?", utils.CurrentWorkspaceID(c)).Order("id").Find(&hooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": hooks})
+}
+
+// GetWebhook handles GET /api/webhooks/:id
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+	webhook.Secret = ""
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook handles PUT /api/webhooks/:id
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if req.URL != nil {
+		webhook.URL = *req.URL
+	}
+	if req.Events != nil {
+		webhook.Events = strings.Join(*req.Events, ",")
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if err := h.db.WithContext(c.Request.Context()).Model(&webhook).Select("url", "events", "active").Updates(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+	utils.RecordAudit(c, h.db, models.AuditWebhookUpdate, "webhook", []uint{webhook.ID}, req)
+	webhook.Secret = ""
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook handles DELETE /api/webhooks/:id
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	h.db.WithContext(c.Request.Context()).Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{})
+	if err := h.db.WithContext(c.Request.Context()).Delete(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditWebhookDelete, "webhook", []uint{webhook.ID}, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetDeliveries handles GET /api/webhooks/:id/deliveries
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+
+	var deliveries []models.WebhookDelivery
+	var total int64
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+	query.Count(&total)
+
+	if err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	response := models.WebhookDeliveryListResponse{
+		Deliveries: deliveries,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// TestWebhook handles POST /api/webhooks/:id/test by replaying the last event
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.dispatcher.Replay(c.Request.Context(), webhook)
+	if errors.Is(err, webhooks.ErrNoEvents) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook has no events to replay yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// findWebhook loads the caller's webhook named by the :id parameter, writing
+// an error response if it can't.
+func (h *WebhookHandler) findWebhook(c *gin.Context) (models.Webhook, bool) {
+	var webhook models.Webhook
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return webhook, false
+	}
+	if err := h.db.WithContext(c.Request.Context()).Where("workspace_id = ?", utils.CurrentWorkspaceID(c)).First(&webhook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return webhook, false
+	}
+	return webhook, true
+}
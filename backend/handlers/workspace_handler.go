@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+	"gorm.io/gorm"
+)
+
+type WorkspaceHandler struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceHandler(db *gorm.DB) *WorkspaceHandler {
+	return &WorkspaceHandler{db: db}
+}
+
+// GetCurrentWorkspace handles GET /api/workspace
+func (h *WorkspaceHandler) GetCurrentWorkspace(c *gin.Context) {
+	var workspace models.Workspace
+	if err := h.db.WithContext(c.Request.Context()).First(&workspace, utils.CurrentWorkspaceID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// CreateWorkspace handles POST /api/workspaces
+// Only admins of the default workspace may create workspaces. The response
+// carries an admin key for the new workspace, which is shown only once.
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	if !requireDefaultWorkspace(c) {
+		return
+	}
+
+	var req models.CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var response models.CreateWorkspaceResponse
+	err := h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		response.Workspace = models.Workspace{Name: req.Name, DailyAnalysisQuota: req.DailyAnalysisQuota}
+		if err := tx.Create(&response.Workspace).Error; err != nil {
+			return err
+		}
+
+		var err error
+		response.AdminKey, err = createAPIKey(tx, models.APIKey{
+			WorkspaceID: response.Workspace.ID,
+			Name:        "admin",
+			Scopes:      string(models.ScopeAdmin),
+		})
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workspace"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditWorkspaceCreate, "workspace", []uint{response.Workspace.ID}, gin.H{"name": response.Workspace.Name})
+	c.JSON(http.StatusCreated, response)
+}
+
+// SetWorkspaceQuota handles PUT /api/workspaces/:id/quota
+// Only admins of the default workspace may change quotas, so workspaces
+// cannot lift their own.
+func (h *WorkspaceHandler) SetWorkspaceQuota(c *gin.Context) {
+	if !requireDefaultWorkspace(c) {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return
+	}
+
+	var req models.SetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var workspace models.Workspace
+	if err := h.db.WithContext(c.Request.Context()).First(&workspace, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	workspace.DailyAnalysisQuota = *req.DailyAnalysisQuota
+	if err := h.db.WithContext(c.Request.Context()).Model(&workspace).Update("daily_analysis_quota", workspace.DailyAnalysisQuota).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quota"})
+		return
+	}
+
+	utils.RecordAudit(c, h.db, models.AuditWorkspaceQuota, "workspace", []uint{workspace.ID}, req)
+	c.JSON(http.StatusOK, workspace)
+}
+
+// requireDefaultWorkspace writes a 403 response unless the caller belongs to
+// the default workspace.
+func requireDefaultWorkspace(c *gin.Context) bool {
+	if utils.CurrentWorkspaceID(c) != models.DefaultWorkspaceID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins of the default workspace can manage workspaces"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sykell/backend/events"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/tracing"
+	"github.com/sykell/backend/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrJobNotRunning is returned when a job was cancelled or deleted before its
+// result could be saved
+var ErrJobNotRunning = errors.New("analysis job is no longer running")
+
+// Analyzer crawls a job's URL and persists the analysis result. Progress is
+// published to bus, which may be nil.
+type Analyzer struct {
+	db      *gorm.DB
+	crawler *utils.CrawlerService
+	bus     *events.Bus
+}
+
+func NewAnalyzer(db *gorm.DB, crawler *utils.CrawlerService, bus *events.Bus) *Analyzer {
+	return &Analyzer{
+		db:      db,
+		crawler: crawler,
+		bus:     bus,
+	}
+}
+
+// Process is a Processor that analyzes the URL referenced by job.
+func (a *Analyzer) Process(ctx context.Context, job *models.AnalysisJob) error {
+	url, err := a.loadURL(ctx, job.URLID)
+	if err != nil {
+		return err
+	}
+
+	if models.CrawlMode(url.CrawlMode) == models.CrawlModeSite {
+		return a.processSite(ctx, url, job)
+	}
+
+	// Perform analysis
+	result, brokenLinks, err := a.crawler.AnalyzeURL(ctx, url.URL, utils.CrawlOptions{
+		IgnoreRobots: url.IgnoreRobots,
+		Progress:     a.bus.ProgressReporter(job),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Don't persist anything for an analysis that was cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Set URL ID
+	result.URLID = url.ID
+	result.JobID = &job.ID
+	result.PageURL = url.URL
+	result.PagesCrawled = 1
+
+	return a.persist(ctx, job, func(tx *gorm.DB) error {
+		version, err := nextVersion(tx, url.ID)
+		if err != nil {
+			return err
+		}
+		result.Version = version
+		return saveResult(tx, result, brokenLinks)
+	})
+}
+
+func (a *Analyzer) loadURL(ctx context.Context, id uint) (models.URL, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "analysis.load_url")
+	defer span.End()
+
+	var url models.URL
+	if err := a.db.WithContext(ctx).First(&url, id).Error; err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return url, fmt.Errorf("failed to load URL: %w", err)
+	}
+	span.SetAttributes(attribute.String("url.crawl_mode", url.CrawlMode))
+	return url, nil
+}
+
+// persist runs the transaction that stores an analysis run in its own span.
+// The job row stays locked while saving, so a cancel or delete that came
+// after the last ctx check either waits for the result or leaves none.
+func (a *Analyzer) persist(ctx context.Context, job *models.AnalysisJob, save func(tx *gorm.DB) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, "analysis.save_result", trace.WithAttributes(attribute.Int64("url.id", int64(job.URLID))))
+	defer span.End()
+
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current models.AnalysisJob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&current, job.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && current.Status != string(models.JobRunning)) {
+			return ErrJobNotRunning
+		}
+		if err != nil {
+			return err
+		}
+		return save(tx)
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// processSite crawls the URL's site and stores an aggregate result with one
+// child result per visited page.
+func (a *Analyzer) processSite(ctx context.Context, url models.URL, job *models.AnalysisJob) error {
+	maxDepth, maxPages := url.MaxDepth, url.MaxPages
+	if maxDepth < 1 {
+		maxDepth = utils.DefaultCrawlDepth
+	}
+	if maxPages < 1 {
+		maxPages = utils.DefaultCrawlPages
+	}
+
+	pages, err := a.crawler.CrawlSite(ctx, url.URL, utils.CrawlOptions{
+		IgnoreRobots: url.IgnoreRobots,
+		MaxDepth:     maxDepth,
+		MaxPages:     maxPages,
+		Progress:     a.bus.ProgressReporter(job),
+	})
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	parent := utils.AggregateCrawl(pages)
+	parent.URLID = url.ID
+	parent.JobID = &job.ID
+	parent.PageURL = url.URL
+
+	return a.persist(ctx, job, func(tx *gorm.DB) error {
+		version, err := nextVersion(tx, url.ID)
+		if err != nil {
+			return err
+		}
+		parent.Version = version
+		if err := saveResult(tx, parent, nil); err != nil {
+			return err
+		}
+		for _, page := range pages {
+			page.Result.URLID = url.ID
+			page.Result.JobID = &job.ID
+			page.Result.Version = version
+			page.Result.ParentID = &parent.ID
+			page.Result.PageURL = page.URL
+			page.Result.Depth = page.Depth
+			page.Result.PagesCrawled = 1
+			if err := saveResult(tx, page.Result, page.BrokenLinks); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// nextVersion returns the version number for the URL's next analysis run.
+// Only one job per URL runs at a time, so this cannot race with itself.
+func nextVersion(tx *gorm.DB, urlID uint) (int, error) {
+	var latest int
+	err := tx.Model(&models.AnalysisResult{}).
+		Where("url_id = ? AND parent_id IS NULL", urlID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latest).Error
+	return latest + 1, err
+}
+
+func saveResult(tx *gorm.DB, result *models.AnalysisResult, brokenLinks []models.BrokenLink) error {
+	if err := tx.Create(result).Error; err != nil {
+		return fmt.Errorf("failed to save analysis result: %w", err)
+	}
+
+	for i := range brokenLinks {
+		brokenLinks[i].AnalysisID = result.ID
+	}
+	if len(brokenLinks) > 0 {
+		if err := tx.Create(&brokenLinks).Error; err != nil {
+			return fmt.Errorf("failed to save broken links: %w", err)
+		}
+	}
+	return nil
+}
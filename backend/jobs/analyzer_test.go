@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sykell/backend/events"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+)
+
+func TestAnalyzerKeepsHistory(t *testing.T) {
+	title := "First"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%s</title></head><body><h1>Hi</h1></body></html>", title)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, server.URL+"/")
+	bus := events.NewBus(0)
+	sub, _, _ := bus.Subscribe("", nil)
+	defer sub.Close()
+	analyzer := NewAnalyzer(db, utils.NewCrawlerService(utils.DefaultCrawlerConfig()), bus)
+
+	for i, next := range []string{"Second", ""} {
+		job := models.AnalysisJob{URLID: url.ID, Status: string(models.JobRunning)}
+		db.Create(&job)
+		if err := analyzer.Process(context.Background(), &job); err != nil {
+			t.Fatalf("run %d: Process() error = %v", i+1, err)
+		}
+		title = next
+	}
+
+	var runs []models.AnalysisResult
+	db.Where("url_id = ?", url.ID).Order("version").Find(&runs)
+	if len(runs) != 2 {
+		t.Fatalf("stored %d runs, want 2", len(runs))
+	}
+	if runs[0].Version != 1 || runs[0].Title != "First" || runs[1].Version != 2 || runs[1].Title != "Second" {
+		t.Errorf("runs = v%d %q, v%d %q, want v1 First, v2 Second", runs[0].Version, runs[0].Title, runs[1].Version, runs[1].Title)
+	}
+	if runs[1].JobID == nil || *runs[1].JobID == *runs[0].JobID {
+		t.Errorf("runs should record their own job IDs, got %v and %v", runs[0].JobID, runs[1].JobID)
+	}
+
+	// Each run reports fetching and then checking links
+	var stages []utils.CrawlStage
+	for len(sub.C) > 0 {
+		event := <-sub.C
+		if event.Type == events.TypeProgress && event.URLID == url.ID {
+			stages = append(stages, event.Progress.Stage)
+		}
+	}
+	if len(stages) != 4 || stages[0] != utils.StageFetching || stages[1] != utils.StageCheckingLinks {
+		t.Errorf("progress stages = %v, want fetching and checking_links per run", stages)
+	}
+}
+
+func TestAnalyzerDiscardsCancelledRun(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	var job models.AnalysisJob
+	// The job is cancelled while its page is being fetched
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			db.Model(&job).Update("status", models.JobCancelled)
+		}
+		fmt.Fprint(w, "<!DOCTYPE html><html><head><title>Gone</title></head><body><a href=\"/missing\">x</a></body></html>")
+	}))
+	defer server.Close()
+
+	url := createURL(t, db, server.URL+"/")
+	job = models.AnalysisJob{URLID: url.ID, Status: string(models.JobRunning)}
+	db.Create(&job)
+	analyzer := NewAnalyzer(db, utils.NewCrawlerService(utils.DefaultCrawlerConfig()), nil)
+
+	if err := analyzer.Process(context.Background(), &job); !errors.Is(err, ErrJobNotRunning) {
+		t.Fatalf("Process() error = %v, want ErrJobNotRunning", err)
+	}
+	var results, links int64
+	db.Model(&models.AnalysisResult{}).Count(&results)
+	db.Model(&models.BrokenLink{}).Count(&links)
+	if results != 0 || links != 0 {
+		t.Errorf("stored %d results and %d broken links for a cancelled run, want none", results, links)
+	}
+}
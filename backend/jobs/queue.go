@@ -0,0 +1,598 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Processor runs a single claimed job. A returned error marks the job as failed.
+type Processor func(ctx context.Context, job *models.AnalysisJob) error
+
+// StatusListener is told about every status change of an analysis job. It
+// runs on the goroutine that made the change, so it must not block.
+type StatusListener func(job models.AnalysisJob)
+
+// Queue is a database-backed job queue drained by a fixed pool of workers.
+type Queue struct {
+	db                *gorm.DB
+	workers           int
+	pollInterval      time.Duration
+	heartbeatInterval time.Duration
+	leaseTimeout      time.Duration
+	maxAttempts       int
+	process           Processor
+	wake              chan struct{}
+	wg                sync.WaitGroup
+	listeners         []StatusListener
+
+	// stop is closed by Shutdown; abandon is set once its deadline passes
+	stop     chan struct{}
+	stopOnce sync.Once
+	abandon  atomic.Bool
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+}
+
+// ErrNoActiveJob is returned by Cancel when the URL has nothing queued or running.
+var ErrNoActiveJob = errors.New("no active analysis job")
+
+const (
+	DefaultPollInterval      = 2 * time.Second
+	DefaultHeartbeatInterval = 15 * time.Second
+	// DefaultLeaseTimeout is how long a running job may go without a
+	// heartbeat before it is considered abandoned.
+	DefaultLeaseTimeout = 2 * time.Minute
+	DefaultMaxAttempts  = 3
+)
+
+func NewQueue(db *gorm.DB, workers int, process Processor) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Queue{
+		db:                db,
+		workers:           workers,
+		pollInterval:      DefaultPollInterval,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		leaseTimeout:      DefaultLeaseTimeout,
+		maxAttempts:       DefaultMaxAttempts,
+		process:           process,
+		wake:              make(chan struct{}, 1),
+		stop:              make(chan struct{}),
+		running:           make(map[uint]context.CancelFunc),
+	}
+}
+
+// Enqueue schedules an analysis of the given URL. If the URL already has a
+// queued or running job, that job is returned instead of creating a new one.
+// The request ID in ctx, if any, is stored with the job for its logs.
+func (q *Queue) Enqueue(ctx context.Context, urlID uint) (*models.AnalysisJob, error) {
+	job, _, err := q.enqueueOne(ctx, urlID)
+	return job, err
+}
+
+// enqueueOne is Enqueue that also reports whether a new job was created.
+func (q *Queue) enqueueOne(ctx context.Context, urlID uint) (*models.AnalysisJob, bool, error) {
+	var job models.AnalysisJob
+	created := false
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = enqueue(ctx, tx, urlID, &job)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		q.emit(job)
+	}
+	q.notify()
+	return &job, created, nil
+}
+
+// CreateAndEnqueue inserts url and queues its first analysis in one
+// transaction, so a URL is never left without a job.
+func (q *Queue) CreateAndEnqueue(ctx context.Context, url *models.URL) (*models.AnalysisJob, error) {
+	var job models.AnalysisJob
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(url).Error; err != nil {
+			return err
+		}
+		_, err := enqueue(ctx, tx, url.ID, &job)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.emit(job)
+	q.notify()
+	return &job, nil
+}
+
+// enqueue creates a job for the URL inside tx unless it already has an active
+// one, which is loaded into job instead. The URL row is locked first so that
+// concurrent calls cannot both create a job.
+func enqueue(ctx context.Context, tx *gorm.DB, urlID uint, job *models.AnalysisJob) (bool, error) {
+	var url models.URL
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "workspace_id").First(&url, urlID).Error; err != nil {
+		return false, err
+	}
+
+	err := tx.Where("url_id = ? AND status IN ?", urlID, models.ActiveJobStatuses).First(job).Error
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	*job = models.AnalysisJob{
+		URLID:       urlID,
+		WorkspaceID: url.WorkspaceID,
+		Status:      string(models.JobQueued),
+		RequestID:   logging.RequestID(ctx),
+		TraceParent: tracing.Inject(ctx),
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return false, err
+	}
+	return true, tx.Model(&models.URL{}).Where("id = ?", urlID).Update("status", models.StatusQueued).Error
+}
+
+// EnqueueBatch schedules analyses for many URLs at once. URLs that already
+// have a queued or running job are left alone.
+func (q *Queue) EnqueueBatch(ctx context.Context, urlIDs []uint) error {
+	if len(urlIDs) == 0 {
+		return nil
+	}
+
+	var jobs []models.AnalysisJob
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the URLs keeps a concurrent Enqueue from adding a second job
+		var urls []models.URL
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "workspace_id").
+			Where("id IN ?", urlIDs).Order("id").Find(&urls).Error; err != nil {
+			return err
+		}
+
+		var active []uint
+		if err := tx.Model(&models.AnalysisJob{}).
+			Where("url_id IN ? AND status IN ?", urlIDs, models.ActiveJobStatuses).
+			Pluck("url_id", &active).Error; err != nil {
+			return err
+		}
+		skip := make(map[uint]bool, len(active))
+		for _, id := range active {
+			skip[id] = true
+		}
+
+		workspaceOf := make(map[uint]uint, len(urls))
+		for _, url := range urls {
+			workspaceOf[url.ID] = url.WorkspaceID
+		}
+
+		requestID, traceParent := logging.RequestID(ctx), tracing.Inject(ctx)
+		var queued []uint
+		for _, id := range urlIDs {
+			workspaceID, exists := workspaceOf[id]
+			if skip[id] || !exists {
+				continue
+			}
+			skip[id] = true
+			jobs = append(jobs, models.AnalysisJob{URLID: id, WorkspaceID: workspaceID, Status: string(models.JobQueued), RequestID: requestID, TraceParent: traceParent})
+			queued = append(queued, id)
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		if err := tx.CreateInBatches(&jobs, 500).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.URL{}).Where("id IN ?", queued).Update("status", models.StatusQueued).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		q.emit(job)
+	}
+	q.notify()
+	return nil
+}
+
+// OnStatusChange registers a listener for job status changes. Listeners must
+// be registered before Start.
+func (q *Queue) OnStatusChange(listener StatusListener) {
+	q.listeners = append(q.listeners, listener)
+}
+
+func (q *Queue) emit(job models.AnalysisJob) {
+	for _, listener := range q.listeners {
+		listener(job)
+	}
+}
+
+// Start launches the worker pool, along with a loop that keeps recovering
+// abandoned jobs. Workers stop once ctx is cancelled.
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+	q.wg.Add(1)
+	go q.recoverLoop(ctx)
+	slog.Info("Started analysis workers", "workers", q.workers)
+}
+
+// Wait blocks until every worker has returned.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Shutdown stops the workers from claiming new jobs and waits for running
+// analyses to finish. If ctx ends first, the remaining analyses are cancelled
+// and put back in the queue for the next start, and ctx's error is returned.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.abandon.Store(true)
+	q.mu.Lock()
+	for _, cancel := range q.running {
+		cancel()
+	}
+	q.mu.Unlock()
+	<-done
+	return ctx.Err()
+}
+
+func (q *Queue) stopping() bool {
+	select {
+	case <-q.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// recoverLoop runs Recover every half lease, so jobs left running by a
+// process that died, including one restarted before their lease expired, are
+// picked up even though the startup scan skipped them.
+func (q *Queue) recoverLoop(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.leaseTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			if _, err := q.Recover(); err != nil {
+				slog.Error("Failed to recover analysis jobs", "error", err)
+			}
+		}
+	}
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil || q.stopping() {
+			return
+		}
+
+		job, err := q.claim()
+		if err != nil {
+			slog.Error("Failed to claim analysis job", "error", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			// Pass the wake-up on in case more jobs are waiting
+			q.notify()
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim atomically moves the oldest queued job to running. It returns nil
+// when there is nothing to do.
+func (q *Queue) claim() (*models.AnalysisJob, error) {
+	for {
+		var job models.AnalysisJob
+		err := q.db.Where("status = ?", models.JobQueued).Order("id").First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		claimed := false
+		err = q.db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.AnalysisJob{}).
+				Where("id = ? AND status = ?", job.ID, models.JobQueued).
+				Updates(map[string]interface{}{
+					"status":       models.JobRunning,
+					"started_at":   now,
+					"heartbeat_at": now,
+					"attempts":     gorm.Expr("attempts + 1"),
+				})
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			claimed = true
+			return tx.Model(&models.URL{}).Where("id = ?", job.URLID).Update("status", models.StatusRunning).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			// Another worker got there first, try the next job
+			continue
+		}
+
+		job.Status = string(models.JobRunning)
+		job.StartedAt = &now
+		job.HeartbeatAt = &now
+		job.Attempts++
+		q.emit(job)
+		return &job, nil
+	}
+}
+
+func (q *Queue) run(ctx context.Context, job *models.AnalysisJob) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	if q.abandon.Load() {
+		// Claimed just as Shutdown gave up waiting
+		cancel()
+	}
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}()
+
+	// The job gets its own trace, linked to the request that queued it
+	var spanOpts []trace.SpanStartOption
+	if origin := tracing.Extract(job.TraceParent); origin.IsValid() {
+		spanOpts = append(spanOpts, trace.WithLinks(trace.Link{SpanContext: origin}))
+	}
+	spanOpts = append(spanOpts, trace.WithNewRoot(), trace.WithAttributes(
+		attribute.Int64("job.id", int64(job.ID)),
+		attribute.Int64("url.id", int64(job.URLID)),
+		attribute.Int("job.attempt", job.Attempts),
+		attribute.String("request.id", job.RequestID),
+	))
+	jobCtx, span := tracing.Tracer().Start(jobCtx, "analysis.job", spanOpts...)
+	defer span.End()
+
+	// Everything logged for this job carries the request that queued it
+	logger := slog.Default().With("job_id", job.ID, "url_id", job.URLID, "attempt", job.Attempts)
+	if job.RequestID != "" {
+		logger = logger.With("request_id", job.RequestID)
+	}
+	if span.SpanContext().IsValid() {
+		logger = logger.With("trace_id", span.SpanContext().TraceID().String())
+	}
+	jobCtx = logging.WithLogger(jobCtx, logger)
+
+	logger.Info("Analysis started")
+	start := time.Now()
+	stop := q.startHeartbeat(job.ID, cancel)
+	err := q.process(jobCtx, job)
+	stop()
+
+	if err != nil && jobCtx.Err() != nil && q.abandon.Load() {
+		if q.requeue(job) {
+			logger.Info("Analysis interrupted by shutdown, requeued", "duration", time.Since(start))
+			return
+		}
+	}
+
+	jobStatus, urlStatus, errMsg := models.JobDone, models.StatusDone, ""
+	switch {
+	case err != nil && jobCtx.Err() != nil:
+		jobStatus, urlStatus, errMsg = models.JobFailed, models.StatusError, err.Error()
+		logger.Info("Analysis stopped", "error", err, "duration", time.Since(start))
+	case err != nil:
+		jobStatus, urlStatus, errMsg = models.JobFailed, models.StatusError, err.Error()
+		logger.Warn("Analysis failed", "error", err, "duration", time.Since(start))
+		span.SetStatus(codes.Error, err.Error())
+	default:
+		logger.Info("Analysis finished", "duration", time.Since(start))
+	}
+
+	// A cancelled job already has its final status, so only finish jobs
+	// that are still marked as running. The job and its URL change together.
+	now := time.Now()
+	finished := false
+	err = q.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.AnalysisJob{}).Where("id = ? AND status = ?", job.ID, models.JobRunning).Updates(map[string]interface{}{
+			"status":      jobStatus,
+			"error":       errMsg,
+			"finished_at": now,
+		})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		finished = true
+		return tx.Model(&models.URL{}).Where("id = ?", job.URLID).Update("status", urlStatus).Error
+	})
+	if err != nil {
+		// Still running without a heartbeat, so recovery picks it up again
+		logger.Error("Failed to record analysis outcome", "error", err)
+		return
+	}
+	if finished {
+		job.Status = string(jobStatus)
+		job.Error = errMsg
+		job.FinishedAt = &now
+		q.emit(*job)
+	}
+}
+
+// requeue puts a job interrupted by Shutdown back in the queue without
+// counting the attempt. It reports false if the job was no longer running,
+// e.g. because it was cancelled.
+func (q *Queue) requeue(job *models.AnalysisJob) bool {
+	res := q.db.Model(&models.AnalysisJob{}).Where("id = ? AND status = ?", job.ID, models.JobRunning).Updates(map[string]interface{}{
+		"status":       models.JobQueued,
+		"started_at":   nil,
+		"heartbeat_at": nil,
+		"attempts":     gorm.Expr("attempts - 1"),
+	})
+	if res.Error != nil {
+		slog.Error("Failed to requeue interrupted analysis job", "job_id", job.ID, "error", res.Error)
+		return false
+	}
+	if res.RowsAffected == 0 {
+		return false
+	}
+
+	q.db.Model(&models.URL{}).Where("id = ?", job.URLID).Update("status", models.StatusQueued)
+	job.Status = string(models.JobQueued)
+	job.StartedAt = nil
+	job.HeartbeatAt = nil
+	job.Attempts--
+	q.emit(*job)
+	return true
+}
+
+// Cancel stops the URL's queued or running analysis. Running jobs owned by
+// another process are stopped at their next heartbeat.
+func (q *Queue) Cancel(urlID uint) (*models.AnalysisJob, error) {
+	var job models.AnalysisJob
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("url_id = ? AND status IN ?", urlID, models.ActiveJobStatuses).First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNoActiveJob
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		res := tx.Model(&models.AnalysisJob{}).
+			Where("id = ? AND status = ?", job.ID, job.Status).
+			Updates(map[string]interface{}{
+				"status":      models.JobCancelled,
+				"error":       "cancelled by user",
+				"finished_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// The job finished while we were looking at it
+			return ErrNoActiveJob
+		}
+		job.Status = string(models.JobCancelled)
+		job.Error = "cancelled by user"
+		job.FinishedAt = &now
+		return tx.Model(&models.URL{}).Where("id = ?", urlID).Update("status", models.StatusCancelled).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	if cancel, ok := q.running[job.ID]; ok {
+		cancel()
+	}
+	q.mu.Unlock()
+
+	q.emit(job)
+	return &job, nil
+}
+
+// startHeartbeat periodically refreshes the job's lease until the returned
+// stop function is called. If the job is no longer running, for example
+// because it was cancelled elsewhere, cancel is called.
+func (q *Queue) startHeartbeat(jobID uint, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(q.heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				res := q.db.Model(&models.AnalysisJob{}).
+					Where("id = ? AND status = ?", jobID, models.JobRunning).
+					Update("heartbeat_at", time.Now())
+				if res.Error == nil && res.RowsAffected == 0 {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
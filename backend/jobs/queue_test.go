@@ -0,0 +1,462 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testModels are the tables the queue, analyzer and scheduler use
+var testModels = []any{&models.URL{}, &models.AnalysisResult{}, &models.BrokenLink{}, &models.AnalysisJob{},
+	&models.Workspace{}, &models.AnalysisUsage{}}
+
+// newTestDB opens a fresh SQLite database holding the given models. It is
+// closed when the test ends.
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func createURL(t *testing.T, db *gorm.DB, rawURL string) models.URL {
+	t.Helper()
+
+	url := models.URL{URL: rawURL, Status: string(models.StatusQueued)}
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	return url
+}
+
+func waitForURLStatus(t *testing.T, db *gorm.DB, id uint, want models.URLStatus) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var url models.URL
+		if err := db.First(&url, id).Error; err == nil && url.Status == string(want) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("URL %d never reached status %q", id, want)
+}
+
+func TestEnqueueReusesActiveJob(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, "https://example.com")
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+
+	first, err := queue.Enqueue(context.Background(), url.ID)
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	second, err := queue.Enqueue(context.Background(), url.ID)
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	if first.ID != second.ID {
+		t.Errorf("Enqueue() created job %d, want existing job %d", second.ID, first.ID)
+	}
+
+	var count int64
+	db.Model(&models.AnalysisJob{}).Count(&count)
+	if count != 1 {
+		t.Errorf("job count = %d, want 1", count)
+	}
+}
+
+func TestCreateAndEnqueue(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+
+	url := models.URL{URL: "https://example.com", Status: string(models.StatusQueued)}
+	job, err := queue.CreateAndEnqueue(context.Background(), &url)
+	if err != nil {
+		t.Fatalf("CreateAndEnqueue() error = %v", err)
+	}
+	if url.ID == 0 || job.URLID != url.ID || job.Status != string(models.JobQueued) {
+		t.Errorf("CreateAndEnqueue() = URL %d, job %+v; want a queued job for the new URL", url.ID, job)
+	}
+
+	// A failed enqueue leaves no URL behind
+	if err := db.Migrator().DropTable(&models.AnalysisJob{}); err != nil {
+		t.Fatalf("Failed to drop jobs table: %v", err)
+	}
+	orphan := models.URL{URL: "https://example.org", Status: string(models.StatusQueued)}
+	if _, err := queue.CreateAndEnqueue(context.Background(), &orphan); err == nil {
+		t.Fatal("CreateAndEnqueue() succeeded without a jobs table")
+	}
+	var count int64
+	db.Model(&models.URL{}).Where("url = ?", orphan.URL).Count(&count)
+	if count != 0 {
+		t.Errorf("URL without a job was kept")
+	}
+}
+
+func TestConcurrentEnqueueCreatesOneJob(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, "https://example.com")
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(batch bool) {
+			defer wg.Done()
+			var err error
+			if batch {
+				err = queue.EnqueueBatch(context.Background(), []uint{url.ID})
+			} else {
+				_, err = queue.Enqueue(context.Background(), url.ID)
+			}
+			if err != nil {
+				t.Errorf("enqueue error = %v", err)
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+
+	var count int64
+	db.Model(&models.AnalysisJob{}).Count(&count)
+	if count != 1 {
+		t.Errorf("job count = %d, want 1", count)
+	}
+}
+
+func TestQueueProcessesJobs(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	ok := createURL(t, db, "https://example.com")
+	bad := createURL(t, db, "https://example.org")
+
+	var processed int32
+	queue := NewQueue(db, 2, func(ctx context.Context, job *models.AnalysisJob) error {
+		atomic.AddInt32(&processed, 1)
+		if job.URLID == bad.ID {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.Start(ctx)
+	defer func() {
+		cancel()
+		queue.Wait()
+	}()
+
+	if _, err := queue.Enqueue(context.Background(), ok.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if _, err := queue.Enqueue(context.Background(), bad.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	waitForURLStatus(t, db, ok.ID, models.StatusDone)
+	waitForURLStatus(t, db, bad.ID, models.StatusError)
+
+	var failed models.AnalysisJob
+	db.Where("url_id = ?", bad.ID).First(&failed)
+	if failed.Status != string(models.JobFailed) || failed.Error != "boom" || failed.Attempts != 1 {
+		t.Errorf("failed job = %+v, want status failed, error boom, 1 attempt", failed)
+	}
+	if got := atomic.LoadInt32(&processed); got != 2 {
+		t.Errorf("processed %d jobs, want 2", got)
+	}
+}
+
+func TestStatusListener(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, "https://example.com")
+
+	statuses := make(chan string, 10)
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+	queue.OnStatusChange(func(job models.AnalysisJob) {
+		statuses <- job.Status
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.Start(ctx)
+	defer func() {
+		cancel()
+		queue.Wait()
+	}()
+
+	if _, err := queue.Enqueue(context.Background(), url.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	for _, want := range []models.JobStatus{models.JobQueued, models.JobRunning, models.JobDone} {
+		select {
+		case got := <-statuses:
+			if got != string(want) {
+				t.Fatalf("status change = %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for status %q", want)
+		}
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, "https://example.com")
+
+	started := make(chan struct{})
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.Start(ctx)
+	defer func() {
+		cancel()
+		queue.Wait()
+	}()
+
+	if _, err := queue.Enqueue(context.Background(), url.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never started")
+	}
+
+	job, err := queue.Cancel(url.ID)
+	if err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if job.Status != string(models.JobCancelled) {
+		t.Errorf("Cancel() job status = %q, want %q", job.Status, models.JobCancelled)
+	}
+	waitForURLStatus(t, db, url.ID, models.StatusCancelled)
+
+	if _, err := queue.Cancel(url.ID); !errors.Is(err, ErrNoActiveJob) {
+		t.Errorf("second Cancel() error = %v, want ErrNoActiveJob", err)
+	}
+}
+
+func TestShutdownWaitsForRunningJob(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, "https://example.com")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error {
+		close(started)
+		<-release
+		return nil
+	})
+	queue.Start(context.Background())
+
+	if _, err := queue.Enqueue(context.Background(), url.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never started")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- queue.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown() returned %v before the job finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	waitForURLStatus(t, db, url.ID, models.StatusDone)
+
+	// Stopped workers leave new jobs queued
+	other := createURL(t, db, "https://example.org")
+	if _, err := queue.Enqueue(context.Background(), other.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	var job models.AnalysisJob
+	db.Where("url_id = ?", other.ID).First(&job)
+	if job.Status != string(models.JobQueued) {
+		t.Errorf("job enqueued after Shutdown has status %q, want %q", job.Status, models.JobQueued)
+	}
+}
+
+func TestShutdownRequeuesUnfinishedJob(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, "https://example.com")
+
+	started := make(chan struct{})
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	queue.Start(context.Background())
+
+	if _, err := queue.Enqueue(context.Background(), url.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := queue.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	var job models.AnalysisJob
+	if err := db.Where("url_id = ?", url.ID).First(&job).Error; err != nil {
+		t.Fatalf("Failed to load job: %v", err)
+	}
+	if job.Status != string(models.JobQueued) || job.Attempts != 0 || job.StartedAt != nil {
+		t.Errorf("job = status %q, attempts %d, started %v; want queued, 0 attempts, not started",
+			job.Status, job.Attempts, job.StartedAt)
+	}
+	waitForURLStatus(t, db, url.ID, models.StatusQueued)
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+
+	first := createURL(t, db, "https://example.com")
+	second := createURL(t, db, "https://example.org")
+	if _, err := queue.Enqueue(context.Background(), first.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	if err := queue.EnqueueBatch(context.Background(), []uint{first.ID, second.ID, second.ID}); err != nil {
+		t.Fatalf("EnqueueBatch() error = %v", err)
+	}
+
+	var count int64
+	db.Model(&models.AnalysisJob{}).Count(&count)
+	if count != 2 {
+		t.Errorf("job count = %d, want 2", count)
+	}
+}
+
+func TestEnqueueCopiesWorkspace(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	queue := NewQueue(db, 1, nil)
+
+	url := models.URL{WorkspaceID: 7, URL: "https://example.com", Status: string(models.StatusDone)}
+	db.Create(&url)
+
+	job, err := queue.Enqueue(context.Background(), url.ID)
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if job.WorkspaceID != 7 {
+		t.Errorf("job workspace = %d, want 7", job.WorkspaceID)
+	}
+	if _, err := queue.Enqueue(context.Background(), url.ID+1); err == nil {
+		t.Error("Enqueue() of a missing URL succeeded")
+	}
+}
+
+func TestJobLogsCarryRequestID(t *testing.T) {
+	var buf syncBuffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	db := newTestDB(t, testModels...)
+	url := createURL(t, db, "https://example.com")
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error {
+		logging.FromContext(ctx).Info("fetching page")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.Start(ctx)
+	defer func() {
+		cancel()
+		queue.Wait()
+	}()
+
+	job, err := queue.Enqueue(logging.WithRequestID(context.Background(), "req-123"), url.ID)
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if job.RequestID != "req-123" {
+		t.Errorf("job request ID = %q, want req-123", job.RequestID)
+	}
+	waitForURLStatus(t, db, url.ID, models.StatusDone)
+
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		if entry["msg"] == "fetching page" {
+			found = true
+			if entry["request_id"] != "req-123" || entry["job_id"] != float64(job.ID) {
+				t.Errorf("analysis log = %v, want request_id req-123 and job_id %d", entry, job.ID)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("analysis log line missing from:\n%s", buf.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer that workers and the test can share
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+)
+
+// RecoveryReport summarizes what Recover did with orphaned work.
+type RecoveryReport struct {
+	Requeued int
+	Failed   int
+	Orphans  int
+}
+
+// Recover repairs state left behind by a process that died mid-analysis.
+// Running jobs whose lease has expired are requeued, or failed once they
+// have used up their attempts, and URLs stuck in queued/running without an
+// active job get a fresh one. It runs at startup and then periodically from
+// Start, since jobs of a process that died only moments ago are still leased
+// at startup. The report counts only jobs and URLs it actually changed.
+func (q *Queue) Recover() (RecoveryReport, error) {
+	var report RecoveryReport
+
+	var stale []models.AnalysisJob
+	cutoff := time.Now().Add(-q.leaseTimeout)
+	err := q.db.Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", models.JobRunning, cutoff).
+		Find(&stale).Error
+	if err != nil {
+		return report, fmt.Errorf("failed to find stale jobs: %w", err)
+	}
+
+	for _, job := range stale {
+		requeue := job.Attempts < q.maxAttempts
+		changed := false
+		err := q.db.Transaction(func(tx *gorm.DB) error {
+			jobStatus, urlStatus := models.JobQueued, models.StatusQueued
+			jobUpdates := map[string]interface{}{"status": jobStatus, "heartbeat_at": nil}
+			if !requeue {
+				now := time.Now()
+				job.Error = fmt.Sprintf("abandoned after %d attempts", job.Attempts)
+				job.FinishedAt = &now
+				jobStatus, urlStatus = models.JobFailed, models.StatusError
+				jobUpdates = map[string]interface{}{
+					"status":      jobStatus,
+					"error":       job.Error,
+					"finished_at": now,
+				}
+			}
+
+			// Only touch the job if nobody revived it in the meantime
+			res := tx.Model(&models.AnalysisJob{}).
+				Where("id = ? AND status = ?", job.ID, models.JobRunning).
+				Updates(jobUpdates)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			changed = true
+			job.Status = string(jobStatus)
+			return tx.Model(&models.URL{}).Where("id = ?", job.URLID).Update("status", urlStatus).Error
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to recover job %d: %w", job.ID, err)
+		}
+		if !changed {
+			continue
+		}
+		q.emit(job)
+		if requeue {
+			report.Requeued++
+		} else {
+			report.Failed++
+		}
+	}
+
+	var orphanIDs []uint
+	err = q.db.Model(&models.URL{}).
+		Where("status IN ?", []models.URLStatus{models.StatusQueued, models.StatusRunning}).
+		Where("id NOT IN (?)", q.db.Model(&models.AnalysisJob{}).Select("url_id").Where("status IN ?", models.ActiveJobStatuses)).
+		Pluck("id", &orphanIDs).Error
+	if err != nil {
+		return report, fmt.Errorf("failed to find orphaned URLs: %w", err)
+	}
+	for _, id := range orphanIDs {
+		_, created, err := q.enqueueOne(context.Background(), id)
+		if err != nil {
+			return report, fmt.Errorf("failed to requeue URL %d: %w", id, err)
+		}
+		if created {
+			report.Orphans++
+		}
+	}
+
+	if report.Requeued+report.Failed+report.Orphans > 0 {
+		slog.Info("Recovered analysis jobs",
+			"requeued", report.Requeued, "failed", report.Failed, "orphaned_urls_requeued", report.Orphans)
+		q.notify()
+	}
+	return report, nil
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sykell/backend/models"
+)
+
+func TestRecover(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+
+	stale := time.Now().Add(-time.Hour)
+	fresh := time.Now()
+
+	retry := createURL(t, db, "https://retry.example.com")
+	exhausted := createURL(t, db, "https://exhausted.example.com")
+	alive := createURL(t, db, "https://alive.example.com")
+	orphan := createURL(t, db, "https://orphan.example.com")
+	db.Model(&models.URL{}).Where("id IN ?", []uint{retry.ID, exhausted.ID, alive.ID, orphan.ID}).
+		Update("status", models.StatusRunning)
+
+	jobs := []models.AnalysisJob{
+		{URLID: retry.ID, Status: string(models.JobRunning), Attempts: 1, HeartbeatAt: &stale},
+		{URLID: exhausted.ID, Status: string(models.JobRunning), Attempts: DefaultMaxAttempts, HeartbeatAt: &stale},
+		{URLID: alive.ID, Status: string(models.JobRunning), Attempts: 1, HeartbeatAt: &fresh},
+	}
+	if err := db.Create(&jobs).Error; err != nil {
+		t.Fatalf("Failed to create jobs: %v", err)
+	}
+
+	report, err := queue.Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	want := RecoveryReport{Requeued: 1, Failed: 1, Orphans: 1}
+	if report != want {
+		t.Errorf("Recover() = %+v, want %+v", report, want)
+	}
+
+	tests := []struct {
+		url       models.URL
+		urlStatus models.URLStatus
+		jobStatus models.JobStatus
+	}{
+		{retry, models.StatusQueued, models.JobQueued},
+		{exhausted, models.StatusError, models.JobFailed},
+		{alive, models.StatusRunning, models.JobRunning},
+		{orphan, models.StatusQueued, models.JobQueued},
+	}
+	for _, tt := range tests {
+		var url models.URL
+		db.First(&url, tt.url.ID)
+		if url.Status != string(tt.urlStatus) {
+			t.Errorf("%s status = %q, want %q", tt.url.URL, url.Status, tt.urlStatus)
+		}
+		var job models.AnalysisJob
+		db.Where("url_id = ?", tt.url.ID).Order("id desc").First(&job)
+		if job.Status != string(tt.jobStatus) {
+			t.Errorf("%s job status = %q, want %q", tt.url.URL, job.Status, tt.jobStatus)
+		}
+	}
+}
+
+func TestRecoverLoop(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+	queue.leaseTimeout = 200 * time.Millisecond
+
+	// Still leased at startup, as after a quick restart
+	url := createURL(t, db, "https://example.com")
+	db.Model(&url).Update("status", models.StatusRunning)
+	now := time.Now()
+	job := models.AnalysisJob{URLID: url.ID, Status: string(models.JobRunning), Attempts: 1, HeartbeatAt: &now}
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	report, err := queue.Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if report != (RecoveryReport{}) {
+		t.Errorf("Recover() = %+v, want nothing recovered while the lease holds", report)
+	}
+
+	queue.Start(context.Background())
+	defer queue.Shutdown(context.Background())
+	waitForURLStatus(t, db, url.ID, models.StatusDone)
+}
@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultScheduleInterval is how often the scheduler looks for due URLs
+	DefaultScheduleInterval = 30 * time.Second
+	// scheduleBatchSize caps how many due URLs are enqueued per tick
+	scheduleBatchSize = 500
+)
+
+// Scheduler enqueues analyses for URLs whose recurring schedule is due.
+type Scheduler struct {
+	db       *gorm.DB
+	queue    *Queue
+	interval time.Duration
+	wg       sync.WaitGroup
+}
+
+func NewScheduler(db *gorm.DB, queue *Queue) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		queue:    queue,
+		interval: DefaultScheduleInterval,
+	}
+}
+
+// Start checks for due URLs right away and then every interval until ctx is
+// cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.RunDue(time.Now().UTC()); err != nil {
+				slog.Error("Failed to run scheduled analyses", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait blocks until the goroutine started by Start has returned.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// RunDue enqueues an analysis for every URL whose next run is at or before
+// now and moves its next run forward. It returns how many URLs were enqueued.
+func (s *Scheduler) RunDue(now time.Time) (int, error) {
+	var due []models.URL
+	if err := s.db.Where("schedule <> '' AND next_run_at <= ?", now).
+		Order("next_run_at").
+		Limit(scheduleBatchSize).
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	enqueued := 0
+	for _, url := range due {
+		schedule, err := utils.ParseSchedule(url.Schedule)
+		if err != nil {
+			// Stop retrying a schedule that no longer parses
+			slog.Warn("Disabling invalid schedule", "url_id", url.ID, "schedule", url.Schedule, "error", err)
+			s.db.Model(&models.URL{}).Where("id = ?", url.ID).Update("next_run_at", nil)
+			continue
+		}
+
+		// Only the instance that moves next_run_at forward enqueues the run
+		result := s.db.Model(&models.URL{}).
+			Where("id = ? AND next_run_at = ?", url.ID, url.NextRunAt).
+			Updates(map[string]interface{}{
+				"next_run_at": schedule.Next(now),
+				"last_run_at": now,
+			})
+		if result.Error != nil {
+			return enqueued, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		// Scheduled runs count against the workspace's daily quota; a run that
+		// doesn't fit is skipped until the next one is due
+		quota, err := utils.ReserveWorkspaceAnalyses(s.db, url.WorkspaceID, 1, now)
+		if err != nil {
+			return enqueued, err
+		}
+		if !quota.Allowed {
+			slog.Warn("Skipping scheduled analysis over the daily quota", "url_id", url.ID, "workspace_id", url.WorkspaceID, "limit", quota.Limit)
+			continue
+		}
+
+		_, created, err := s.queue.enqueueOne(context.Background(), url.ID)
+		if err != nil || !created {
+			// Nothing new was queued, so the reservation goes back
+			if releaseErr := utils.ReleaseWorkspaceAnalyses(s.db, url.WorkspaceID, 1, now); releaseErr != nil {
+				slog.Error("Failed to release analysis quota", "url_id", url.ID, "error", releaseErr)
+			}
+		}
+		if err != nil {
+			return enqueued, err
+		}
+		enqueued++
+	}
+	return enqueued, nil
+}
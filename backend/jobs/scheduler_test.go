@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/utils"
+)
+
+func TestSchedulerRunDue(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+	scheduler := NewScheduler(db, queue)
+	db.Create(&models.Workspace{ID: models.DefaultWorkspaceID, Name: "Default"})
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	due := createURL(t, db, "https://due.example.com")
+	db.Model(&due).Updates(map[string]interface{}{"schedule": "1h", "next_run_at": past})
+	later := createURL(t, db, "https://later.example.com")
+	db.Model(&later).Updates(map[string]interface{}{"schedule": "1h", "next_run_at": future})
+	createURL(t, db, "https://unscheduled.example.com")
+
+	enqueued, err := scheduler.RunDue(now)
+	if err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+	if enqueued != 1 {
+		t.Errorf("RunDue() enqueued %d URLs, want 1", enqueued)
+	}
+
+	var jobs []models.AnalysisJob
+	db.Find(&jobs)
+	if len(jobs) != 1 || jobs[0].URLID != due.ID {
+		t.Fatalf("jobs = %+v, want one job for URL %d", jobs, due.ID)
+	}
+
+	var reloaded models.URL
+	db.First(&reloaded, due.ID)
+	if reloaded.NextRunAt == nil || !reloaded.NextRunAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("next_run_at = %v, want %v", reloaded.NextRunAt, now.Add(time.Hour))
+	}
+	if reloaded.LastRunAt == nil || !reloaded.LastRunAt.Equal(now) {
+		t.Errorf("last_run_at = %v, want %v", reloaded.LastRunAt, now)
+	}
+
+	// Nothing is due until the next run
+	enqueued, err = scheduler.RunDue(now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+	if enqueued != 0 {
+		t.Errorf("second RunDue() enqueued %d URLs, want 0", enqueued)
+	}
+}
+
+func TestSchedulerRunDueRespectsWorkspaceQuota(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	queue := NewQueue(db, 1, func(ctx context.Context, job *models.AnalysisJob) error { return nil })
+	scheduler := NewScheduler(db, queue)
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	db.Create(&models.Workspace{ID: models.DefaultWorkspaceID, Name: "Default", DailyAnalysisQuota: 1})
+	url := createURL(t, db, "https://due.example.com")
+	db.Model(&url).Updates(map[string]interface{}{"schedule": "1h", "next_run_at": now.Add(-time.Minute)})
+
+	// The day's only analysis is already used up
+	if status, err := utils.ReserveWorkspaceAnalyses(db, models.DefaultWorkspaceID, 1, now); err != nil || !status.Allowed {
+		t.Fatalf("ReserveWorkspaceAnalyses() = %+v, %v", status, err)
+	}
+
+	enqueued, err := scheduler.RunDue(now)
+	if err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+	var jobs int64
+	db.Model(&models.AnalysisJob{}).Count(&jobs)
+	if enqueued != 0 || jobs != 0 {
+		t.Errorf("RunDue() enqueued %d URLs and %d jobs exist, want none over the quota", enqueued, jobs)
+	}
+
+	var reloaded models.URL
+	db.First(&reloaded, url.ID)
+	if reloaded.NextRunAt == nil || !reloaded.NextRunAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("next_run_at = %v, want the skipped run's successor %v", reloaded.NextRunAt, now.Add(time.Hour))
+	}
+
+	// A run that queues nothing new gives its reservation back
+	db.Model(&models.Workspace{}).Where("id = ?", models.DefaultWorkspaceID).Update("daily_analysis_quota", 2)
+	if _, err := queue.Enqueue(context.Background(), url.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	db.Model(&reloaded).Update("next_run_at", now)
+	if _, err := scheduler.RunDue(now); err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+	var used int
+	db.Model(&models.AnalysisUsage{}).Where("scope = ? AND owner_id = ?", models.UsageScopeWorkspace, models.DefaultWorkspaceID).
+		Select("used").Scan(&used)
+	if used != 1 {
+		t.Errorf("workspace usage = %d, want 1 after a run that reused the active job", used)
+	}
+}
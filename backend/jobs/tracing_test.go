@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/tracing"
+	"github.com/sykell/backend/utils"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestJobSpanLinksToRequest(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Traced</title></head><body><a href="/missing">gone</a></body></html>`)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t, testModels...)
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		t.Fatalf("Use(GormPlugin) error = %v", err)
+	}
+	url := createURL(t, db, server.URL+"/")
+	queue := NewQueue(db, 1, NewAnalyzer(db, utils.NewCrawlerService(utils.DefaultCrawlerConfig()), nil).Process)
+
+	requestCtx, requestSpan := tracing.Tracer().Start(context.Background(), "POST /api/urls")
+	if _, err := queue.Enqueue(requestCtx, url.ID); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	requestSpan.End()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.Start(ctx)
+	waitForURLStatus(t, db, url.ID, models.StatusDone)
+	cancel()
+	queue.Wait()
+
+	spans := exporter.GetSpans()
+	var job *tracetest.SpanStub
+	for i := range spans {
+		if spans[i].Name == "analysis.job" {
+			job = &spans[i]
+		}
+	}
+	if job == nil {
+		t.Fatalf("no analysis.job span among %d spans", len(spans))
+	}
+	if len(job.Links) != 1 || job.Links[0].SpanContext.SpanID() != requestSpan.SpanContext().SpanID() {
+		t.Errorf("job span links = %+v, want a link to the request span", job.Links)
+	}
+	if job.SpanContext.TraceID() == requestSpan.SpanContext().TraceID() {
+		t.Error("job span should start its own trace")
+	}
+
+	// Every step of the analysis belongs to the job's trace
+	want := map[string]bool{
+		"analysis.load_url":       false,
+		"crawler.AnalyzeURL":      false,
+		"crawler.fetch_page":      false,
+		"crawler.parse_html":      false,
+		"crawler.check_links":     false,
+		"crawler.check_link HEAD": false,
+		"analysis.save_result":    false,
+		"gorm.create":             false,
+	}
+	for _, span := range spans {
+		if _, ok := want[span.Name]; ok && span.SpanContext.TraceID() == job.SpanContext.TraceID() {
+			want[span.Name] = true
+		}
+	}
+	for name, found := range want {
+		if !found {
+			t.Errorf("no %s span in the job's trace", name)
+		}
+	}
+}
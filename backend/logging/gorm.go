@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// DefaultSlowQuery is how long a query may take before it is logged as slow
+const DefaultSlowQuery = 200 * time.Millisecond
+
+// GormLogger sends GORM's logs to slog. Every statement is logged at debug
+// level, slow ones at warn and failed ones at error; a missing record is not
+// treated as a failure.
+type GormLogger struct {
+	logger        *slog.Logger
+	slowThreshold time.Duration
+}
+
+func NewGormLogger(logger *slog.Logger, slowThreshold time.Duration) *GormLogger {
+	return &GormLogger{logger: logger, slowThreshold: slowThreshold}
+}
+
+// LogMode is a no-op; the slog handler's level decides what is written.
+func (g *GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return g
+}
+
+func (g *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	g.log(ctx).InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	g.log(ctx).WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	g.log(ctx).ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	logger := g.log(ctx)
+
+	level, msg := slog.LevelDebug, "Query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "Query failed"
+	case g.slowThreshold > 0 && elapsed > g.slowThreshold:
+		level, msg = slog.LevelWarn, "Slow query"
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Duration("duration", elapsed),
+	}
+	if level == slog.LevelError {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// log prefers the request's logger so queries carry its request ID
+func (g *GormLogger) log(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return g.logger
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		level, format string
+		wantErr       bool
+		wantDebug     bool
+		wantJSON      bool
+	}{
+		{"", "", false, false, false},
+		{"debug", "json", false, true, true},
+		{"WARN", "text", false, false, false},
+		{"verbose", "", true, false, false},
+		{"info", "xml", true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level+"/"+tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := logger.Enabled(context.Background(), slog.LevelDebug); got != tt.wantDebug {
+				t.Errorf("debug enabled = %v, want %v", got, tt.wantDebug)
+			}
+			logger.Warn("hello")
+			if got := strings.HasPrefix(buf.String(), "{"); got != tt.wantJSON {
+				t.Errorf("output %q, want JSON %v", buf.String(), tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		FromContext(c.Request.Context()).Info("handled")
+		c.String(200, RequestID(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"generated", "", false},
+		{"echoed", "abc-123", true},
+		{"unsafe replaced", "bad id\nwith newline", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" || id != w.Body.String() {
+				t.Fatalf("response header %q, handler saw %q", id, w.Body.String())
+			}
+			if (id == tt.incoming) != tt.wantSame {
+				t.Errorf("request ID = %q for incoming %q", id, tt.incoming)
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("log %q is not JSON: %v", buf.String(), err)
+			}
+			if entry["request_id"] != id {
+				t.Errorf("log request_id = %v, want %q", entry["request_id"], id)
+			}
+		})
+	}
+}
+
+func TestGormLogger(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	logger := NewGormLogger(base, 100*time.Millisecond)
+	query := func() (string, int64) { return "SELECT * FROM urls", 1 }
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), query, nil)
+	logger.Trace(ctx, time.Now(), query, gorm.ErrRecordNotFound)
+	if buf.Len() != 0 {
+		t.Errorf("fast queries and missing records logged at info level: %s", buf.String())
+	}
+
+	logger.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+	if !strings.Contains(buf.String(), "level=WARN msg=\"Slow query\"") {
+		t.Errorf("slow query not logged as a warning: %s", buf.String())
+	}
+
+	// Queries made with a request's context use its logger
+	buf.Reset()
+	requestCtx := WithLogger(ctx, base.With("request_id", "req-1"))
+	logger.Trace(requestCtx, time.Now(), query, errors.New("deadlock"))
+	out := buf.String()
+	if !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "error=deadlock") || !strings.Contains(out, "request_id=req-1") {
+		t.Errorf("failed query not logged as an error with its request ID: %s", out)
+	}
+}
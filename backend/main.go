@@ -1,49 +1,205 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sykell/backend/config"
+	"github.com/sykell/backend/events"
+	"github.com/sykell/backend/jobs"
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/metrics"
+	"github.com/sykell/backend/models"
 	"github.com/sykell/backend/routes"
-	"log"
-	"os"
+	"github.com/sykell/backend/tracing"
+	"github.com/sykell/backend/utils"
+	"github.com/sykell/backend/webhooks"
 )
 
+// tracingFlushTimeout bounds sending the last spans on shutdown
+const tracingFlushTimeout = 5 * time.Second
+
 func main() {
-	// Set Gin mode
-	if os.Getenv("GIN_MODE") == "release" {
-		gin.SetMode(gin.ReleaseMode)
+	// Settings come from an optional YAML file, overridden by the environment
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Structured logs
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
 	}
+	slog.SetDefault(logger)
+
+	// Export traces over OTLP when an endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+
+	// SIGINT or SIGTERM starts a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Webhook deliveries and scheduled analyses stop on shutdown
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	gin.SetMode(cfg.Server.GinMode)
 
 	// Initialize database
-	config.InitDB()
+	db := config.InitDB(cfg.Database)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// The admin key lets the first keys be created through the API
+	if key := cfg.Auth.AdminAPIKey; key != "" {
+		if err := utils.EnsureBootstrapKey(db, key); err != nil {
+			logging.Fatal("Failed to create bootstrap API key", "error", err)
+		}
+	} else {
+		var count int64
+		db.Model(&models.APIKey{}).Where("revoked_at IS NULL").Count(&count)
+		if count == 0 {
+			slog.Warn("No API keys exist; set ADMIN_API_KEY to create one")
+		}
 	}
 
-	r := gin.Default()
+	// The web frontend gets its own key without admin rights
+	if key := cfg.Auth.FrontendAPIKey; key != "" {
+		if err := utils.EnsureFrontendKey(db, key); err != nil {
+			logging.Fatal("Failed to create frontend API key", "error", err)
+		}
+	}
+
+	// Start the analysis worker pool
+	crawler := utils.NewCrawlerService(cfg.Crawler)
+	bus := events.NewBus(events.DefaultHistorySize)
+	analyzer := jobs.NewAnalyzer(db, crawler, bus)
+	queue := jobs.NewQueue(db, cfg.Analysis.Workers, analyzer.Process)
+	queue.OnStatusChange(bus.AnalysisStatusChanged)
+
+	// Tell webhook subscribers about every analysis status change
+	dispatcher := webhooks.NewDispatcher(db)
+	queue.OnStatusChange(dispatcher.AnalysisStatusChanged)
+	dispatcher.Start(background)
+
+	// Analysis durations and URL status counts for /metrics
+	queue.OnStatusChange(metrics.AnalysisStatusChanged)
+	metrics.Registry.MustRegister(metrics.NewURLStatusCollector(db))
+
+	// Requeue or fail jobs orphaned by a previous run before taking new work
+	if _, err := queue.Recover(); err != nil {
+		slog.Error("Failed to recover analysis jobs", "error", err)
+	}
+	// Not tied to background: running analyses are drained by queue.Shutdown
+	queue.Start(context.Background())
+	scheduler := jobs.NewScheduler(db, queue)
+	scheduler.Start(background)
+
+	r := gin.New()
+	// Only the configured proxies may set the client IP used in logs and the
+	// audit log
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logging.Fatal("Invalid trusted proxies", "error", err)
+	}
+	r.Use(logging.RequestIDMiddleware(), tracing.Middleware(), logging.AccessLog(), gin.Recovery())
 
 	// Setup CORS for frontend
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		
-		c.Next()
-	})
+	r.Use(utils.CORSMiddleware(cfg.CORS.AllowedOrigins))
+
+	// Per-key request rate limit
+	limiter := utils.NewRateLimiter(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
 
 	// Setup routes
-	routes.SetupRoutes(r)
+	routes.SetupRoutes(r, db, queue, crawler, dispatcher, bus, limiter)
 
-	log.Printf("Starting server on :%s", port)
-	err := r.Run(":" + port)
-	if err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Server.Port), Handler: r}
+	// Open event streams would otherwise keep Shutdown waiting
+	srv.RegisterOnShutdown(bus.Close)
+
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("Starting server", "port", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// /metrics has no auth, so it gets its own listener that can be kept off
+	// the public network
+	var metricsSrv *http.Server
+	if addr := cfg.Server.MetricsAddress; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			slog.Info("Serving metrics", "address", addr)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		logging.Fatal("Failed to start server", "error", err)
+	case <-ctx.Done():
+	}
+	stop()
+	slog.Info("Shutting down", "timeout", cfg.Server.ShutdownTimeout)
+
+	withTimeout := func(timeout time.Duration, f func(context.Context) error) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return f(ctx)
+	}
+
+	// Requests and analyses drain side by side, each getting the whole timeout
+	var draining sync.WaitGroup
+	draining.Add(2)
+	go func() {
+		defer draining.Done()
+		if err := withTimeout(cfg.Server.ShutdownTimeout, srv.Shutdown); err != nil {
+			slog.Error("Server did not shut down cleanly", "error", err)
+		}
+	}()
+	go func() {
+		defer draining.Done()
+		// Analyses still running at the deadline are requeued for the next start
+		if err := withTimeout(cfg.Server.ShutdownTimeout, queue.Shutdown); err != nil {
+			slog.Warn("Analyses did not finish in time and were requeued", "error", err)
+		}
+	}()
+	draining.Wait()
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+
+	// The dispatcher records the last status changes as deliveries as it
+	// stops, so it must finish before the database is closed
+	stopBackground()
+	dispatcher.Wait()
+	scheduler.Wait()
+
+	if err := withTimeout(tracingFlushTimeout, shutdownTracing); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	if err := config.CloseDB(db); err != nil {
+		slog.Error("Failed to close database", "error", err)
 	}
+	slog.Info("Server stopped")
 } 
\ No newline at end of file
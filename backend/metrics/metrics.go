@@ -0,0 +1,107 @@
+// Package metrics exposes Prometheus metrics for the API, the analysis
+// workers and the crawler's outbound requests.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sykell/backend/models"
+)
+
+const namespace = "sykell"
+
+// Registry holds every metric served at /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "API request latency by route, method and response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	analysisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "analysis_duration_seconds",
+		Help:      "Time from an analysis job starting to it finishing, by outcome.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"outcome"})
+
+	outboundRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbound_requests_total",
+		Help:      "Requests sent by the crawler, by response status class or error type.",
+	}, []string{"status_class", "error"})
+
+	linkCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "link_check_duration_seconds",
+		Help:      "Time taken to check one link, including waits for the host limiter.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		analysisDuration,
+		outboundRequests,
+		linkCheckDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the latency and status of every request. Requests that
+// match no route share the "unmatched" label so that scanners cannot create
+// a series per path.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// AnalysisStatusChanged is a jobs.StatusListener that records how long
+// finished analyses ran. Jobs cancelled before they started are not counted.
+func AnalysisStatusChanged(job models.AnalysisJob) {
+	switch models.JobStatus(job.Status) {
+	case models.JobDone, models.JobFailed, models.JobCancelled:
+	default:
+		return
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil {
+		return
+	}
+	analysisDuration.WithLabelValues(job.Status).Observe(job.FinishedAt.Sub(*job.StartedAt).Seconds())
+}
+
+// ObserveFetch counts one outbound request. statusClass is e.g. "2xx", or
+// "error" when no response arrived, in which case errorType says why.
+func ObserveFetch(statusClass, errorType string) {
+	outboundRequests.WithLabelValues(statusClass, errorType).Inc()
+}
+
+// ObserveLinkCheck records how long checking one link took and its result.
+func ObserveLinkCheck(result string, duration time.Duration) {
+	linkCheckDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
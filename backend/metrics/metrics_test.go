@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a fresh SQLite database holding the given models. It is
+// closed when the test ends.
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// histogram returns the sample count and sum of one histogram series.
+func histogram(t *testing.T, vec *prometheus.HistogramVec, labels ...string) (uint64, float64) {
+	t.Helper()
+
+	var m dto.Metric
+	if err := vec.WithLabelValues(labels...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("Failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestMiddlewareLabelsByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/urls/:id", func(c *gin.Context) { c.Status(404) })
+
+	for _, path := range []string{"/api/urls/1", "/api/urls/2", "/wp-login.php"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if count, _ := histogram(t, httpRequestDuration, "GET", "/api/urls/:id", "404"); count != 2 {
+		t.Errorf("route series has %d samples, want 2", count)
+	}
+	if count, _ := histogram(t, httpRequestDuration, "GET", "unmatched", "404"); count != 1 {
+		t.Errorf("unmatched series has %d samples, want 1", count)
+	}
+}
+
+func TestAnalysisStatusChanged(t *testing.T) {
+	started := time.Now()
+	finished := started.Add(3 * time.Second)
+
+	AnalysisStatusChanged(models.AnalysisJob{Status: string(models.JobRunning), StartedAt: &started})
+	// Cancelled while still queued
+	AnalysisStatusChanged(models.AnalysisJob{Status: string(models.JobCancelled), FinishedAt: &finished})
+	AnalysisStatusChanged(models.AnalysisJob{Status: string(models.JobDone), StartedAt: &started, FinishedAt: &finished})
+
+	if count, sum := histogram(t, analysisDuration, "done"); count != 1 || sum != 3 {
+		t.Errorf("done analyses: count %d, sum %v; want 1 taking 3s", count, sum)
+	}
+	if got := testutil.CollectAndCount(analysisDuration); got != 1 {
+		t.Errorf("got %d outcome series, want only done", got)
+	}
+}
+
+func TestURLStatusCollector(t *testing.T) {
+	db := newTestDB(t, &models.URL{})
+	for _, url := range []models.URL{
+		{URL: "https://a.example", Status: string(models.StatusDone)},
+		{URL: "https://b.example", Status: string(models.StatusDone)},
+		{URL: "https://c.example", Status: string(models.StatusError)},
+	} {
+		if err := db.Create(&url).Error; err != nil {
+			t.Fatalf("Failed to create URL: %v", err)
+		}
+	}
+
+	want := `
+# HELP sykell_urls Number of tracked URLs by status, across all workspaces.
+# TYPE sykell_urls gauge
+sykell_urls{status="cancelled"} 0
+sykell_urls{status="done"} 2
+sykell_urls{status="error"} 1
+sykell_urls{status="queued"} 0
+sykell_urls{status="running"} 0
+`
+	if err := testutil.CollectAndCompare(NewURLStatusCollector(db), strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+)
+
+var urlStatuses = []models.URLStatus{
+	models.StatusQueued,
+	models.StatusRunning,
+	models.StatusDone,
+	models.StatusError,
+	models.StatusCancelled,
+}
+
+// URLStatusCollector reports how many URLs are in each status, counted from
+// the database at scrape time so every API instance reports the same numbers.
+type URLStatusCollector struct {
+	db   *gorm.DB
+	desc *prometheus.Desc
+}
+
+func NewURLStatusCollector(db *gorm.DB) *URLStatusCollector {
+	return &URLStatusCollector{
+		db: db,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "urls"),
+			"Number of tracked URLs by status, across all workspaces.", []string{"status"}, nil),
+	}
+}
+
+func (u *URLStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- u.desc
+}
+
+func (u *URLStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := u.db.Model(&models.URL{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		ch <- prometheus.NewInvalidMetric(u.desc, err)
+		return
+	}
+
+	counts := make(map[string]int64, len(urlStatuses))
+	for _, status := range urlStatuses {
+		counts[string(status)] = 0
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(u.desc, prometheus.GaugeValue, float64(count), status)
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// AnalysisRef identifies one side of an AnalysisDiff.
+type AnalysisRef struct {
+	ID        uint      `json:"id"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CountDelta struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Delta int `json:"delta"`
+}
+
+type TextChange struct {
+	Changed bool   `json:"changed"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+type LoginFormChange struct {
+	From bool `json:"from"`
+	To   bool `json:"to"`
+	// Change is "appeared", "disappeared" or "unchanged"
+	Change string `json:"change"`
+}
+
+type AnalysisDiff struct {
+	URLID         uint                  `json:"url_id"`
+	From          AnalysisRef           `json:"from"`
+	To            AnalysisRef           `json:"to"`
+	Title         TextChange            `json:"title"`
+	HTMLVersion   TextChange            `json:"html_version"`
+	Headings      map[string]CountDelta `json:"headings"`
+	InternalLinks CountDelta            `json:"internal_links"`
+	ExternalLinks CountDelta            `json:"external_links"`
+	BrokenLinks   CountDelta            `json:"broken_links"`
+	NewlyBroken   []BrokenLink          `json:"newly_broken"`
+	NewlyFixed    []BrokenLink          `json:"newly_fixed"`
+	LoginForm     LoginFormChange       `json:"login_form"`
+}
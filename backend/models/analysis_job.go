@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+type AnalysisJob struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	URLID       uint   `json:"url_id" gorm:"not null;index"`
+	WorkspaceID uint   `json:"workspace_id" gorm:"not null;default:1"`
+	Status      string `json:"status" gorm:"type:varchar(16);not null;default:'queued';index"`
+	Attempts    int    `json:"attempts" gorm:"not null;default:0"`
+	Error       string `json:"error"`
+	// RequestID is the ID of the API request that queued the job, if any
+	RequestID string `json:"request_id" gorm:"type:varchar(64);not null;default:''"`
+	// TraceParent links the job's trace to the request that queued it
+	TraceParent string     `json:"-" gorm:"type:varchar(64);not null;default:''"`
+	StartedAt   *time.Time `json:"started_at"`
+	HeartbeatAt *time.Time `json:"heartbeat_at" gorm:"index"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// ActiveJobStatuses are the job states that still own their URL.
+var ActiveJobStatuses = []string{string(JobQueued), string(JobRunning)}
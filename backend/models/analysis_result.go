@@ -5,34 +5,123 @@ import (
 )
 
 type AnalysisResult struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	URLID         uint      `json:"url_id" gorm:"not null;uniqueIndex"`
-	URL           URL       `json:"url" gorm:"foreignKey:URLID"`
-	Title         string    `json:"title"`
-	HTMLVersion   string    `json:"html_version"`
-	H1Count       int       `json:"h1_count"`
-	H2Count       int       `json:"h2_count"`
-	H3Count       int       `json:"h3_count"`
-	H4Count       int       `json:"h4_count"`
-	H5Count       int       `json:"h5_count"`
-	H6Count       int       `json:"h6_count"`
-	InternalLinks int       `json:"internal_links"`
-	ExternalLinks int       `json:"external_links"`
-	BrokenLinks   int       `json:"broken_links"`
-	HasLoginForm  bool      `json:"has_login_form"`
-	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	URLID           uint      `json:"url_id" gorm:"not null;index:idx_analysis_results_url_parent"`
+	URL             URL       `json:"url" gorm:"foreignKey:URLID"`
+	ParentID        *uint     `json:"parent_id,omitempty" gorm:"index:idx_analysis_results_url_parent"`
+	Version         int       `json:"version" gorm:"not null;default:1"`
+	JobID           *uint     `json:"job_id,omitempty" gorm:"index"`
+	PageURL         string    `json:"page_url,omitempty" gorm:"type:varchar(2048)"`
+	Depth           int       `json:"depth"`
+	PagesCrawled    int       `json:"pages_crawled"`
+	Title           string    `json:"title"`
+	HTMLVersion     string    `json:"html_version"`
+	H1Count         int       `json:"h1_count"`
+	H2Count         int       `json:"h2_count"`
+	H3Count         int       `json:"h3_count"`
+	H4Count         int       `json:"h4_count"`
+	H5Count         int       `json:"h5_count"`
+	H6Count         int       `json:"h6_count"`
+	InternalLinks   int       `json:"internal_links"`
+	ExternalLinks   int       `json:"external_links"`
+	BrokenLinks     int       `json:"broken_links"`
+	DisallowedLinks int       `json:"disallowed_links"`
+	HasLoginForm    bool      `json:"has_login_form"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// CheckedLinks are the links whose status this result covers; only the
+	// first few of a page are checked. Nil for runs made before it was kept.
+	CheckedLinks []string `json:"-" gorm:"serializer:json;type:mediumtext"`
 }
 
 type BrokenLink struct {
-	ID            uint   `json:"id" gorm:"primaryKey"`
-	AnalysisID    uint   `json:"analysis_id" gorm:"not null"`
-	URL           string `json:"url" gorm:"not null"`
-	StatusCode    int    `json:"status_code"`
-	ErrorMessage  string `json:"error_message"`
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	AnalysisID   uint   `json:"analysis_id" gorm:"not null"`
+	URL          string `json:"url" gorm:"not null"`
+	StatusCode   int    `json:"status_code"`
+	ErrorMessage string `json:"error_message"`
+	Outcome      string `json:"outcome" gorm:"type:varchar(16);not null;default:'broken'"`
+}
+
+type LinkOutcome string
+
+const (
+	// LinkBroken links failed to load or returned an error status
+	LinkBroken LinkOutcome = "broken"
+	// LinkDisallowed links were not checked because robots.txt forbids it
+	LinkDisallowed LinkOutcome = "disallowed"
+	// LinkRateLimited links kept answering 429 after we backed off
+	LinkRateLimited LinkOutcome = "rate_limited"
+)
+
+// AnalysisSummary is the headline numbers of an analysis, as sent to webhooks
+// and exports.
+type AnalysisSummary struct {
+	ID              uint      `json:"id"`
+	Version         int       `json:"version"`
+	Title           string    `json:"title"`
+	HTMLVersion     string    `json:"html_version"`
+	H1Count         int       `json:"h1_count"`
+	H2Count         int       `json:"h2_count"`
+	H3Count         int       `json:"h3_count"`
+	H4Count         int       `json:"h4_count"`
+	H5Count         int       `json:"h5_count"`
+	H6Count         int       `json:"h6_count"`
+	PagesCrawled    int       `json:"pages_crawled"`
+	InternalLinks   int       `json:"internal_links"`
+	ExternalLinks   int       `json:"external_links"`
+	BrokenLinks     int       `json:"broken_links"`
+	DisallowedLinks int       `json:"disallowed_links"`
+	HasLoginForm    bool      `json:"has_login_form"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func NewAnalysisSummary(result AnalysisResult) *AnalysisSummary {
+	return &AnalysisSummary{
+		ID:              result.ID,
+		Version:         result.Version,
+		Title:           result.Title,
+		HTMLVersion:     result.HTMLVersion,
+		H1Count:         result.H1Count,
+		H2Count:         result.H2Count,
+		H3Count:         result.H3Count,
+		H4Count:         result.H4Count,
+		H5Count:         result.H5Count,
+		H6Count:         result.H6Count,
+		PagesCrawled:    result.PagesCrawled,
+		InternalLinks:   result.InternalLinks,
+		ExternalLinks:   result.ExternalLinks,
+		BrokenLinks:     result.BrokenLinks,
+		DisallowedLinks: result.DisallowedLinks,
+		HasLoginForm:    result.HasLoginForm,
+		CreatedAt:       result.CreatedAt,
+	}
+}
+
+type AnalysisHistoryResponse struct {
+	Analyses   []AnalysisResult `json:"analyses"`
+	Total      int64            `json:"total"`
+	Page       int              `json:"page"`
+	PageSize   int              `json:"page_size"`
+	TotalPages int              `json:"total_pages"`
 }
 
 type AnalysisDetailResponse struct {
-	AnalysisResult AnalysisResult `json:"analysis_result"`
-	BrokenLinks    []BrokenLink   `json:"broken_links"`
-} 
\ No newline at end of file
+	AnalysisResult AnalysisResult   `json:"analysis_result"`
+	BrokenLinks    []BrokenLink     `json:"broken_links"`
+	Pages          []AnalysisResult `json:"pages,omitempty"`
+}
+
+// URLExport is one record of a URL export: the URL, its latest analysis and,
+// if requested, that analysis's broken links.
+type URLExport struct {
+	ID          uint             `json:"id"`
+	URL         string           `json:"url"`
+	Status      string           `json:"status"`
+	CrawlMode   string           `json:"crawl_mode"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Analysis    *AnalysisSummary `json:"analysis"`
+	BrokenLinks []BrokenLink     `json:"broken_links,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// UsageScope says whether an AnalysisUsage row counts an API key's or a
+// workspace's analyses.
+type UsageScope string
+
+const (
+	UsageScopeKey       UsageScope = "key"
+	UsageScopeWorkspace UsageScope = "workspace"
+)
+
+// AnalysisUsage counts the analyses requested through the API by one key or
+// workspace on one UTC day, for enforcing daily quotas.
+type AnalysisUsage struct {
+	ID      uint   `gorm:"primaryKey"`
+	Scope   string `gorm:"type:varchar(16);not null;uniqueIndex:idx_analysis_usages_owner_day,priority:1"`
+	OwnerID uint   `gorm:"not null;uniqueIndex:idx_analysis_usages_owner_day,priority:2"`
+	// Day is the UTC date as YYYY-MM-DD
+	Day  string `gorm:"type:varchar(10);not null;uniqueIndex:idx_analysis_usages_owner_day,priority:3"`
+	Used int    `gorm:"not null;default:0"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey authenticates API callers. Only a SHA-256 hash of the key is stored;
+// the key itself is shown once when it is created.
+type APIKey struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint   `json:"workspace_id" gorm:"not null;default:1;index"`
+	Name        string `json:"name" gorm:"type:varchar(100);not null"`
+	// Prefix is the start of the key, kept so keys can be told apart
+	Prefix string `json:"prefix" gorm:"type:varchar(16);not null"`
+	Hash   string `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	// Scopes is a comma-separated list of the scopes the key grants
+	Scopes string `json:"scopes" gorm:"type:varchar(255);not null;default:'urls:read,urls:write,urls:delete'"`
+	// DailyAnalysisQuota caps the analyses the key may request per UTC day,
+	// on top of its workspace's quota; 0 means unlimited
+	DailyAnalysisQuota int        `json:"daily_analysis_quota" gorm:"not null;default:0"`
+	LastUsedAt         *time.Time `json:"last_used_at"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	RevokedAt          *time.Time `json:"revoked_at"`
+	CreatedAt          time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt          time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// Managed names the setting, such as ADMIN_API_KEY, that the key comes
+	// from; changing the setting revokes the key
+	Managed string `json:"-" gorm:"type:varchar(32);not null;default:''"`
+}
+
+type Scope string
+
+const (
+	ScopeURLsRead   Scope = "urls:read"
+	ScopeURLsWrite  Scope = "urls:write"
+	ScopeURLsDelete Scope = "urls:delete"
+	// ScopeAdmin grants every other scope and key and webhook management
+	ScopeAdmin Scope = "admin"
+)
+
+// HasScope reports whether the key grants scope.
+func (k *APIKey) HasScope(scope Scope) bool {
+	for _, s := range strings.Split(k.Scopes, ",") {
+		if Scope(s) == scope || Scope(s) == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyRequest struct {
+	Name               string     `json:"name" binding:"required,max=100"`
+	Scopes             []string   `json:"scopes" binding:"required,min=1,dive,oneof=urls:read urls:write urls:delete admin"`
+	DailyAnalysisQuota int        `json:"daily_analysis_quota" binding:"min=0"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey
+	// Key is the secret to send as a Bearer token; it cannot be retrieved later
+	Key string `json:"key"`
+}
+
+// StreamTicketResponse is a single-use ticket for opening one event stream.
+type StreamTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogAppendOnly is returned when something tries to change or remove
+// an audit log entry.
+var ErrAuditLogAppendOnly = errors.New("audit log is append-only")
+
+// AuditLog records one successful mutation made through the API.
+type AuditLog struct {
+	ID          uint `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint `json:"workspace_id" gorm:"not null;index:idx_audit_logs_workspace_created,priority:1"`
+	// APIKeyID, Actor and ActorPrefix identify the key that made the request
+	APIKeyID    uint            `json:"api_key_id" gorm:"not null;index"`
+	Actor       string          `json:"actor" gorm:"type:varchar(100);not null"`
+	ActorPrefix string          `json:"actor_prefix" gorm:"type:varchar(16);not null"`
+	Action      AuditAction     `json:"action" gorm:"type:varchar(32);not null;index"`
+	TargetType  string          `json:"target_type" gorm:"type:varchar(16);not null"`
+	TargetIDs   IDList          `json:"target_ids" gorm:"type:mediumtext"`
+	Details     json.RawMessage `json:"details,omitempty" gorm:"type:text"`
+	IP          string          `json:"ip" gorm:"type:varchar(45);not null"`
+	CreatedAt   time.Time       `json:"created_at" gorm:"autoCreateTime;index:idx_audit_logs_workspace_created,priority:2"`
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error { return ErrAuditLogAppendOnly }
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error { return ErrAuditLogAppendOnly }
+
+type AuditAction string
+
+const (
+	AuditURLCreate        AuditAction = "url.create"
+	AuditURLImport        AuditAction = "url.import"
+	AuditURLSitemapImport AuditAction = "url.sitemap_import"
+	AuditURLUpdate        AuditAction = "url.update"
+	AuditURLDelete        AuditAction = "url.delete"
+	AuditURLReanalyze     AuditAction = "url.reanalyze"
+	AuditURLCancel        AuditAction = "url.cancel"
+	AuditScheduleSet      AuditAction = "url.schedule_set"
+	AuditScheduleClear    AuditAction = "url.schedule_clear"
+	AuditWebhookCreate    AuditAction = "webhook.create"
+	AuditWebhookUpdate    AuditAction = "webhook.update"
+	AuditWebhookDelete    AuditAction = "webhook.delete"
+	AuditKeyCreate        AuditAction = "key.create"
+	AuditKeyRevoke        AuditAction = "key.revoke"
+	AuditWorkspaceCreate  AuditAction = "workspace.create"
+	AuditWorkspaceQuota   AuditAction = "workspace.quota"
+)
+
+// IDList is a list of row IDs stored as ",1,2,3," so a single ID can be
+// matched with LIKE '%,<id>,%'. It is a JSON array in API responses.
+type IDList []uint
+
+func (l IDList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	b.WriteByte(',')
+	for _, id := range l {
+		b.WriteString(strconv.FormatUint(uint64(id), 10))
+		b.WriteByte(',')
+	}
+	return b.String(), nil
+}
+
+func (l *IDList) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into IDList", value)
+	}
+
+	*l = IDList{}
+	for _, part := range strings.Split(strings.Trim(raw, ","), ",") {
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, uint(id))
+	}
+	return nil
+}
+
+func (l IDList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]uint(l))
+}
+
+type AuditLogListResponse struct {
+	Entries    []AuditLog `json:"entries"`
+	Total      int64      `json:"total"`
+	Page       int        `json:"page"`
+	PageSize   int        `json:"page_size"`
+	TotalPages int        `json:"total_pages"`
+}
@@ -5,24 +5,56 @@ import (
 )
 
 type URL struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	URL       string    `json:"url" gorm:"type:varchar(512);not null;uniqueIndex"`
-	Status    string    `json:"status" gorm:"not null;default:'queued'"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint   `json:"workspace_id" gorm:"not null;default:1;uniqueIndex:idx_urls_workspace_url,priority:1"`
+	URL         string `json:"url" gorm:"type:varchar(512);not null;uniqueIndex:idx_urls_workspace_url,priority:2"`
+	Status      string `json:"status" gorm:"not null;default:'queued'"`
+	CrawlMode   string `json:"crawl_mode" gorm:"type:varchar(8);not null;default:'page'"`
+	MaxDepth    int    `json:"max_depth" gorm:"not null;default:0"`
+	MaxPages    int    `json:"max_pages" gorm:"not null;default:0"`
+	// IgnoreRobots skips robots.txt checks for this URL
+	IgnoreRobots bool `json:"ignore_robots" gorm:"not null;default:false"`
+	// Schedule is a cron expression or interval for recurring re-analysis
+	Schedule  string     `json:"schedule" gorm:"type:varchar(64);not null;default:''"`
+	NextRunAt *time.Time `json:"next_run_at" gorm:"index"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
 type URLStatus string
 
 const (
-	StatusQueued  URLStatus = "queued"
-	StatusRunning URLStatus = "running"
-	StatusDone    URLStatus = "done"
-	StatusError   URLStatus = "error"
+	StatusQueued    URLStatus = "queued"
+	StatusRunning   URLStatus = "running"
+	StatusDone      URLStatus = "done"
+	StatusError     URLStatus = "error"
+	StatusCancelled URLStatus = "cancelled"
+)
+
+type CrawlMode string
+
+const (
+	// CrawlModePage analyzes only the submitted page
+	CrawlModePage CrawlMode = "page"
+	// CrawlModeSite follows internal links from the submitted page
+	CrawlModeSite CrawlMode = "site"
 )
 
 type CreateURLRequest struct {
-	URL string `json:"url" binding:"required,url"`
+	URL          string `json:"url" binding:"required,url"`
+	CrawlMode    string `json:"crawl_mode" binding:"omitempty,oneof=page site"`
+	MaxDepth     int    `json:"max_depth" binding:"omitempty,min=1,max=5"`
+	MaxPages     int    `json:"max_pages" binding:"omitempty,min=1,max=500"`
+	IgnoreRobots bool   `json:"ignore_robots"`
+}
+
+type UpdateURLRequest struct {
+	IgnoreRobots *bool `json:"ignore_robots" binding:"required"`
+}
+
+type SetScheduleRequest struct {
+	Schedule string `json:"schedule" binding:"required"`
 }
 
 type URLListResponse struct {
@@ -31,4 +63,39 @@ type URLListResponse struct {
 	Page       int   `json:"page"`
 	PageSize   int   `json:"page_size"`
 	TotalPages int   `json:"total_pages"`
-} 
\ No newline at end of file
+}
+
+type SitemapImportRequest struct {
+	URL string `json:"url" binding:"required,url"`
+}
+
+type SitemapImportResponse struct {
+	Found   int `json:"found"`
+	Added   int `json:"added"`
+	Skipped int `json:"skipped"`
+	Invalid int `json:"invalid"`
+}
+
+type ImportLineStatus string
+
+const (
+	ImportAccepted  ImportLineStatus = "accepted"
+	ImportDuplicate ImportLineStatus = "duplicate"
+	ImportRejected  ImportLineStatus = "rejected"
+)
+
+// ImportLineResult reports what happened to one entry of an uploaded URL list.
+type ImportLineResult struct {
+	Line   int              `json:"line"`
+	URL    string           `json:"url"`
+	Status ImportLineStatus `json:"status"`
+	Reason string           `json:"reason,omitempty"`
+}
+
+type BulkImportResponse struct {
+	Total      int                `json:"total"`
+	Accepted   int                `json:"accepted"`
+	Duplicates int                `json:"duplicates"`
+	Rejected   int                `json:"rejected"`
+	Lines      []ImportLineResult `json:"lines"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook is a subscription to analysis status events.
+type Webhook struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint   `json:"workspace_id" gorm:"not null;default:1;index"`
+	URL         string `json:"url" gorm:"type:varchar(512);not null"`
+	// Secret signs every delivery; it is only returned when the webhook is created
+	Secret string `json:"secret,omitempty" gorm:"type:varchar(128);not null"`
+	// Events is a comma-separated list of event names, empty for all events
+	Events    string    `json:"events" gorm:"type:varchar(255);not null;default:''"`
+	Active    bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type WebhookEvent string
+
+const (
+	EventAnalysisQueued    WebhookEvent = "analysis.queued"
+	EventAnalysisRunning   WebhookEvent = "analysis.running"
+	EventAnalysisDone      WebhookEvent = "analysis.done"
+	EventAnalysisError     WebhookEvent = "analysis.error"
+	EventAnalysisCancelled WebhookEvent = "analysis.cancelled"
+)
+
+// WebhookDelivery is one attempt-tracked POST of an event to a webhook.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;index"`
+	Event          string     `json:"event" gorm:"type:varchar(32);not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"type:varchar(16);not null;default:'pending';index:idx_webhook_deliveries_due"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due"`
+	ResponseStatus int        `json:"response_status"`
+	Error          string     `json:"error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookPayload is the JSON body POSTed to webhooks.
+type WebhookPayload struct {
+	Event      WebhookEvent     `json:"event"`
+	OccurredAt time.Time        `json:"occurred_at"`
+	URL        URL              `json:"url"`
+	Job        AnalysisJob      `json:"job"`
+	Analysis   *AnalysisSummary `json:"analysis,omitempty"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=128"`
+	Events []string `json:"events" binding:"omitempty,dive,oneof=analysis.queued analysis.running analysis.done analysis.error analysis.cancelled"`
+}
+
+type UpdateWebhookRequest struct {
+	URL    *string   `json:"url" binding:"omitempty,url"`
+	Events *[]string `json:"events" binding:"omitempty,dive,oneof=analysis.queued analysis.running analysis.done analysis.error analysis.cancelled"`
+	Active *bool     `json:"active"`
+}
+
+type WebhookDeliveryListResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int64             `json:"total"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	TotalPages int               `json:"total_pages"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultWorkspaceID is the workspace created on first start. Rows from
+// before workspaces existed belong to it, and only its admins may create
+// other workspaces.
+const DefaultWorkspaceID uint = 1
+
+// Workspace isolates a team's URLs, analyses, API keys and webhooks.
+type Workspace struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"type:varchar(100);not null"`
+	// DailyAnalysisQuota caps the analyses the workspace's keys may request
+	// per UTC day; 0 means unlimited
+	DailyAnalysisQuota int       `json:"daily_analysis_quota" gorm:"not null;default:0"`
+	CreatedAt          time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt          time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type CreateWorkspaceRequest struct {
+	Name               string `json:"name" binding:"required,max=100"`
+	DailyAnalysisQuota int    `json:"daily_analysis_quota" binding:"min=0"`
+}
+
+type SetQuotaRequest struct {
+	DailyAnalysisQuota *int `json:"daily_analysis_quota" binding:"required,min=0"`
+}
+
+// CreateWorkspaceResponse carries the new workspace's first admin key, which
+// is only ever shown here.
+type CreateWorkspaceResponse struct {
+	Workspace Workspace            `json:"workspace"`
+	AdminKey  CreateAPIKeyResponse `json:"admin_key"`
+}
@@ -0,0 +1,19 @@
+// Package openapi holds the OpenAPI 3 description of the HTTP API.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Spec is the OpenAPI document, kept in openapi.json next to this file
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Handler serves the OpenAPI document
+func Handler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", Spec)
+}
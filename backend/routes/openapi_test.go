@@ -0,0 +1,327 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/sykell/backend/events"
+	"github.com/sykell/backend/jobs"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/openapi"
+	"github.com/sykell/backend/utils"
+	"github.com/sykell/backend/webhooks"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testAdminKey = "sk_openapi_test_admin_key"
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec)
+	if err != nil {
+		t.Fatalf("Failed to load openapi.json: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("openapi.json is invalid: %v", err)
+	}
+	return doc
+}
+
+// newTestDB opens a fresh SQLite database holding the given models. It is
+// closed when the test ends.
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// newTestRouter sets up the full API against a fresh SQLite database. The
+// queue has no workers, so analyses stay queued, and the returned dispatcher
+// is not started, so tests flush its published events themselves.
+func newTestRouter(t *testing.T) (*gin.Engine, *gorm.DB, *webhooks.Dispatcher) {
+	t.Helper()
+
+	db := newTestDB(t, &models.URL{}, &models.AnalysisResult{}, &models.BrokenLink{}, &models.AnalysisJob{},
+		&models.Webhook{}, &models.WebhookDelivery{}, &models.APIKey{}, &models.Workspace{},
+		&models.AuditLog{}, &models.AnalysisUsage{})
+	if err := db.Create(&models.Workspace{ID: models.DefaultWorkspaceID, Name: "Default"}).Error; err != nil {
+		t.Fatalf("Failed to create default workspace: %v", err)
+	}
+	if err := utils.EnsureBootstrapKey(db, testAdminKey); err != nil {
+		t.Fatalf("Failed to create admin key: %v", err)
+	}
+
+	bus := events.NewBus(events.DefaultHistorySize)
+	dispatcher := webhooks.NewDispatcher(db)
+	queue := jobs.NewQueue(db, 1, func(context.Context, *models.AnalysisJob) error { return nil })
+	queue.OnStatusChange(dispatcher.AnalysisStatusChanged)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	SetupRoutes(r, db, queue, utils.NewCrawlerService(utils.DefaultCrawlerConfig()), dispatcher, bus, utils.NewRateLimiter(1000, 1000))
+	return r, db, dispatcher
+}
+
+var ginParam = regexp.MustCompile(`:([a-z_]+)`)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	doc := loadSpec(t)
+	r, _, _ := newTestRouter(t)
+
+	documented := 0
+	for _, route := range r.Routes() {
+		path := ginParam.ReplaceAllString(route.Path, "{$1}")
+		item := doc.Paths.Find(path)
+		if item == nil || item.GetOperation(route.Method) == nil {
+			t.Errorf("%s %s is not in openapi.json", route.Method, path)
+			continue
+		}
+		documented++
+	}
+	if operations := countOperations(doc); operations != documented {
+		t.Errorf("openapi.json has %d operations, but only %d routes exist", operations, documented)
+	}
+}
+
+func countOperations(doc *openapi3.T) int {
+	count := 0
+	for _, item := range doc.Paths.Map() {
+		count += len(item.Operations())
+	}
+	return count
+}
+
+// apiClient sends requests to the router and checks every response against
+// the OpenAPI document.
+type apiClient struct {
+	t      *testing.T
+	r      *gin.Engine
+	router routers.Router
+}
+
+func (a *apiClient) do(method, path, key, contentType string, body []byte, wantStatus int) []byte {
+	a.t.Helper()
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+
+	if w.Code != wantStatus {
+		a.t.Fatalf("%s %s = %d, want %d: %s", method, path, w.Code, wantStatus, w.Body.String())
+	}
+
+	route, pathParams, err := a.router.FindRoute(req)
+	if err != nil {
+		a.t.Fatalf("%s %s has no matching operation: %v", method, path, err)
+	}
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status: w.Code,
+		Header: w.Header(),
+		Body:   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	}
+	if err := openapi3filter.ValidateResponse(context.Background(), input); err != nil {
+		a.t.Errorf("%s %s response does not match openapi.json: %v\n%s", method, path, err, w.Body.String())
+	}
+	return w.Body.Bytes()
+}
+
+func (a *apiClient) json(method, path, key string, body interface{}, wantStatus int) []byte {
+	a.t.Helper()
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			a.t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+	return a.do(method, path, key, "application/json", data, wantStatus)
+}
+
+func TestHandlerResponsesMatchOpenAPI(t *testing.T) {
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", openapi3filter.FileBodyDecoder)
+	defer openapi3filter.UnregisterBodyDecoder("application/x-ndjson")
+
+	doc := loadSpec(t)
+	doc.Servers = nil
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	r, db, dispatcher := newTestRouter(t)
+	a := &apiClient{t: t, r: r, router: router}
+	admin := testAdminKey
+
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hooks.Close()
+
+	a.do("GET", "/healthz", "", "", nil, http.StatusOK)
+	a.do("GET", "/openapi.json", "", "", nil, http.StatusOK)
+	a.do("GET", "/api/urls", "", "", nil, http.StatusUnauthorized)
+
+	// Webhooks first, so analysis events produce deliveries
+	a.json("POST", "/api/webhooks", admin, gin.H{"url": hooks.URL, "events": []string{"analysis.cancelled"}}, http.StatusCreated)
+	a.json("POST", "/api/webhooks", admin, gin.H{"url": "not a url"}, http.StatusBadRequest)
+
+	// URLs
+	a.json("POST", "/api/urls", admin, gin.H{"url": "https://example.com"}, http.StatusCreated)
+	a.json("POST", "/api/urls", admin, gin.H{"url": "https://example.com"}, http.StatusConflict)
+	a.json("POST", "/api/urls", admin, gin.H{"url": "HTTPS://Example.COM#top"}, http.StatusConflict)
+	a.json("POST", "/api/urls", admin, gin.H{"url": "https://example.org", "crawl_mode": "site", "max_depth": 2}, http.StatusCreated)
+	a.do("GET", "/api/urls/1", admin, "", nil, http.StatusOK)
+
+	seedAnalyses(t, db)
+	a.do("GET", "/api/urls?page=1&page_size=5&sort_field=url", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/1", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/1/analyses", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/1/analyses/diff", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/1/analyses/2", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/2/analyses/3", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/99", admin, "", nil, http.StatusNotFound)
+	a.do("GET", "/api/urls/abc", admin, "", nil, http.StatusBadRequest)
+	a.do("GET", "/api/urls/export?format=json&include=broken_links", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/export?format=ndjson", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls/export?format=xml", admin, "", nil, http.StatusBadRequest)
+
+	a.do("POST", "/api/urls/1/reanalyze", admin, "", nil, http.StatusOK)
+	a.do("POST", "/api/urls/1/cancel", admin, "", nil, http.StatusOK)
+	a.do("POST", "/api/urls/1/cancel", admin, "", nil, http.StatusConflict)
+	a.json("PATCH", "/api/urls/1", admin, gin.H{"ignore_robots": true}, http.StatusOK)
+	a.json("PATCH", "/api/urls/1", admin, gin.H{}, http.StatusBadRequest)
+	a.json("PUT", "/api/urls/1/schedule", admin, gin.H{"schedule": "@daily"}, http.StatusOK)
+	a.json("PUT", "/api/urls/1/schedule", admin, gin.H{"schedule": "whenever"}, http.StatusBadRequest)
+	a.do("DELETE", "/api/urls/1/schedule", admin, "", nil, http.StatusOK)
+	a.json("POST", "/api/urls/sitemap", admin, gin.H{}, http.StatusBadRequest)
+
+	var upload bytes.Buffer
+	form := multipart.NewWriter(&upload)
+	part, _ := form.CreateFormFile("file", "urls.txt")
+	io.WriteString(part, "https://example.net\nhttps://example.com\nnot a url\n")
+	form.Close()
+	a.do("POST", "/api/urls/import", admin, form.FormDataContentType(), upload.Bytes(), http.StatusOK)
+
+	a.do("GET", "/api/events?url_ids=x", admin, "", nil, http.StatusBadRequest)
+	a.do("POST", "/api/events/ticket", admin, "", nil, http.StatusCreated)
+	a.do("GET", "/api/events?ticket=st_unknown", "", "", nil, http.StatusUnauthorized)
+
+	// Webhooks
+	dispatcher.Flush()
+	a.do("GET", "/api/webhooks", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/webhooks/1", admin, "", nil, http.StatusOK)
+	a.json("PUT", "/api/webhooks/1", admin, gin.H{"active": false}, http.StatusOK)
+	a.do("POST", "/api/webhooks/1/test", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/webhooks/1/deliveries", admin, "", nil, http.StatusOK)
+	a.do("DELETE", "/api/webhooks/1", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/webhooks/1", admin, "", nil, http.StatusNotFound)
+
+	// Keys and scopes
+	var readOnly models.CreateAPIKeyResponse
+	body := a.json("POST", "/api/keys", admin, gin.H{"name": "reader", "scopes": []string{"urls:read"}}, http.StatusCreated)
+	if err := json.Unmarshal(body, &readOnly); err != nil {
+		t.Fatalf("Failed to decode key: %v", err)
+	}
+	a.do("GET", "/api/keys", admin, "", nil, http.StatusOK)
+	a.json("DELETE", "/api/urls", readOnly.Key, gin.H{"ids": []uint{1}}, http.StatusForbidden)
+	a.do("DELETE", "/api/keys/"+itoa(readOnly.ID), admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/urls", readOnly.Key, "", nil, http.StatusUnauthorized)
+
+	// Workspaces and quotas
+	a.do("GET", "/api/workspace", admin, "", nil, http.StatusOK)
+	var created models.CreateWorkspaceResponse
+	body = a.json("POST", "/api/workspaces", admin, gin.H{"name": "Agency", "daily_analysis_quota": 1}, http.StatusCreated)
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("Failed to decode workspace: %v", err)
+	}
+	agency := created.AdminKey.Key
+	a.json("POST", "/api/urls", agency, gin.H{"url": "https://example.com"}, http.StatusCreated)
+	a.json("POST", "/api/urls", agency, gin.H{"url": "https://example.org"}, http.StatusTooManyRequests)
+	// URLs already in the workspace take no quota
+	upload.Reset()
+	form = multipart.NewWriter(&upload)
+	part, _ = form.CreateFormFile("file", "urls.txt")
+	io.WriteString(part, "https://example.com\n")
+	form.Close()
+	a.do("POST", "/api/urls/import", agency, form.FormDataContentType(), upload.Bytes(), http.StatusOK)
+	a.json("POST", "/api/workspaces", agency, gin.H{"name": "Nested"}, http.StatusForbidden)
+	a.json("PUT", "/api/workspaces/"+itoa(created.Workspace.ID)+"/quota", admin, gin.H{"daily_analysis_quota": 10}, http.StatusOK)
+	a.json("PUT", "/api/workspaces/99/quota", admin, gin.H{"daily_analysis_quota": 10}, http.StatusNotFound)
+
+	a.json("DELETE", "/api/urls", admin, gin.H{"ids": []uint{1, 2}}, http.StatusOK)
+	a.do("GET", "/api/audit-logs?target_type=url", admin, "", nil, http.StatusOK)
+	a.do("GET", "/api/audit-logs?since=yesterday", admin, "", nil, http.StatusBadRequest)
+}
+
+// seedAnalyses stores two runs of URL 1, the second with a broken link, and
+// a site crawl of URL 2 with one page.
+func seedAnalyses(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	first := models.AnalysisResult{URLID: 1, Version: 1, Title: "Example", HTMLVersion: "HTML5", H1Count: 1}
+	second := models.AnalysisResult{URLID: 1, Version: 2, Title: "Example Domain", HTMLVersion: "HTML5", H1Count: 1, BrokenLinks: 1}
+	site := models.AnalysisResult{URLID: 2, Version: 1, PagesCrawled: 2, Title: "Example"}
+	for _, result := range []*models.AnalysisResult{&first, &second, &site} {
+		if err := db.Create(result).Error; err != nil {
+			t.Fatalf("Failed to seed analysis: %v", err)
+		}
+	}
+	page := models.AnalysisResult{URLID: 2, ParentID: &site.ID, Version: 1, PageURL: "https://example.org/about", Depth: 1}
+	if err := db.Create(&page).Error; err != nil {
+		t.Fatalf("Failed to seed page: %v", err)
+	}
+	link := models.BrokenLink{AnalysisID: second.ID, URL: "https://example.com/gone", StatusCode: 404, Outcome: string(models.LinkBroken)}
+	if err := db.Create(&link).Error; err != nil {
+		t.Fatalf("Failed to seed broken link: %v", err)
+	}
+}
+
+func itoa(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
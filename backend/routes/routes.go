@@ -2,29 +2,97 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/events"
 	"github.com/sykell/backend/handlers"
+	"github.com/sykell/backend/jobs"
+	"github.com/sykell/backend/metrics"
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/openapi"
 	"github.com/sykell/backend/utils"
+	"github.com/sykell/backend/webhooks"
+	"gorm.io/gorm"
 )
 
-func SetupRoutes(r *gin.Engine) {
+func SetupRoutes(r *gin.Engine, db *gorm.DB, queue *jobs.Queue, crawler *utils.CrawlerService, dispatcher *webhooks.Dispatcher, bus *events.Bus, limiter *utils.RateLimiter) {
+	r.Use(metrics.Middleware())
+
 	// Health check endpoint (no auth required)
 	r.GET("/healthz", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// API description (no auth required)
+	r.GET("/openapi.json", openapi.Handler)
+
 	// API routes with authentication
 	api := r.Group("/api")
-	api.Use(utils.AuthMiddleware())
+	api.Use(utils.AuthMiddleware(db), utils.RateLimitMiddleware(limiter))
 
-	urlHandler := handlers.NewURLHandler()
+	urlHandler := handlers.NewURLHandler(db, queue, crawler)
+
+	// Per-route scope checks
+	read := utils.RequireScope(models.ScopeURLsRead)
+	write := utils.RequireScope(models.ScopeURLsWrite)
+	del := utils.RequireScope(models.ScopeURLsDelete)
+	admin := utils.RequireScope(models.ScopeAdmin)
 
 	// URL management endpoints
 	urls := api.Group("/urls")
 	{
-		urls.POST("", urlHandler.CreateURL)                    // Add URL
-		urls.GET("", urlHandler.GetURLs)                       // List URLs with pagination
-		urls.GET("/:id", urlHandler.GetURLDetails)             // Get URL details
-		urls.DELETE("", urlHandler.DeleteURLs)                 // Delete selected URLs
-		urls.POST("/:id/reanalyze", urlHandler.ReanalyzeURL)   // Re-analyze URL
+		urls.POST("", write, urlHandler.CreateURL)                             // Add URL
+		urls.POST("/sitemap", write, urlHandler.ImportSitemap)                 // Add URLs from a sitemap
+		urls.POST("/import", write, urlHandler.ImportURLs)                     // Add URLs from a CSV or text upload
+		urls.GET("", read, urlHandler.GetURLs)                                 // List URLs with pagination
+		urls.GET("/export", read, urlHandler.ExportURLs)                       // Export URLs as CSV, JSON or NDJSON
+		urls.GET("/:id", read, urlHandler.GetURLDetails)                       // Get URL details
+		urls.PATCH("/:id", write, urlHandler.UpdateURL)                        // Change crawl settings
+		urls.GET("/:id/analyses", read, urlHandler.GetAnalysisHistory)         // List analysis runs
+		urls.GET("/:id/analyses/diff", read, urlHandler.DiffAnalyses)          // Compare two analysis runs
+		urls.GET("/:id/analyses/:analysis_id", read, urlHandler.GetURLDetails) // Get one analysis run
+		urls.DELETE("", del, urlHandler.DeleteURLs)                            // Delete selected URLs
+		urls.POST("/:id/reanalyze", write, urlHandler.ReanalyzeURL)            // Re-analyze URL
+		urls.POST("/:id/cancel", write, urlHandler.CancelAnalysis)             // Cancel queued or running analysis
+		urls.PUT("/:id/schedule", write, urlHandler.SetSchedule)               // Set recurring re-analysis
+		urls.DELETE("/:id/schedule", write, urlHandler.ClearSchedule)          // Stop recurring re-analysis
+	}
+
+	webhookHandler := handlers.NewWebhookHandler(db, dispatcher)
+
+	// Webhook subscription endpoints
+	hooks := api.Group("/webhooks", admin)
+	{
+		hooks.POST("", webhookHandler.CreateWebhook)               // Subscribe to analysis events
+		hooks.GET("", webhookHandler.GetWebhooks)                  // List webhooks
+		hooks.GET("/:id", webhookHandler.GetWebhook)               // Get webhook
+		hooks.PUT("/:id", webhookHandler.UpdateWebhook)            // Update webhook
+		hooks.DELETE("/:id", webhookHandler.DeleteWebhook)         // Delete webhook
+		hooks.GET("/:id/deliveries", webhookHandler.GetDeliveries) // Delivery log
+		hooks.POST("/:id/test", webhookHandler.TestWebhook)        // Replay the last event
+	}
+
+	// Live status and progress stream. The stream also accepts a ticket
+	// instead of the Authorization header, so it is not part of the api group.
+	tickets := utils.NewStreamTickets()
+	eventsHandler := handlers.NewEventsHandler(bus, tickets)
+	api.POST("/events/ticket", read, eventsHandler.CreateStreamTicket)
+	r.GET("/api/events", utils.StreamAuthMiddleware(db, tickets), utils.RateLimitMiddleware(limiter), read, eventsHandler.StreamEvents)
+
+	// Audit log
+	auditHandler := handlers.NewAuditHandler(db)
+	api.GET("/audit-logs", admin, auditHandler.GetAuditLogs)
+
+	// Workspaces
+	workspaceHandler := handlers.NewWorkspaceHandler(db)
+	api.GET("/workspace", workspaceHandler.GetCurrentWorkspace)
+	api.POST("/workspaces", admin, workspaceHandler.CreateWorkspace)
+	api.PUT("/workspaces/:id/quota", admin, workspaceHandler.SetWorkspaceQuota)
+
+	// API key management
+	keyHandler := handlers.NewAPIKeyHandler(db)
+	keys := api.Group("/keys", admin)
+	{
+		keys.POST("", keyHandler.CreateAPIKey)       // Create a key
+		keys.GET("", keyHandler.GetAPIKeys)          // List keys
+		keys.DELETE("/:id", keyHandler.RevokeAPIKey) // Revoke a key
 	}
-} 
\ No newline at end of file
+}
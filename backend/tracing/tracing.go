@@ -0,0 +1,123 @@
+// Package tracing sets up OpenTelemetry tracing and instruments gin and GORM.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer used throughout the backend
+const InstrumentationName = "github.com/sykell/backend"
+
+// DefaultServiceName is reported when no service name is configured
+const DefaultServiceName = "sykell-backend"
+
+// Config selects where traces are exported.
+type Config struct {
+	// Endpoint is the base URL of an OTLP/HTTP collector, which receives
+	// traces at /v1/traces. TracesEndpoint, if set, is the full URL instead.
+	// Without either, tracing is off.
+	Endpoint       string `yaml:"endpoint"`
+	TracesEndpoint string `yaml:"traces_endpoint"`
+	// ServiceName identifies the backend in traces
+	ServiceName string `yaml:"service_name"`
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{ServiceName: DefaultServiceName}
+}
+
+// Validate reports the first setting tracing cannot work with.
+func (cfg Config) Validate() error {
+	switch {
+	case !validEndpoint(cfg.Endpoint):
+		return errors.New("endpoint must be a URL with a scheme and host")
+	case !validEndpoint(cfg.TracesEndpoint):
+		return errors.New("traces_endpoint must be a URL with a scheme and host")
+	case strings.TrimSpace(cfg.ServiceName) == "":
+		return errors.New("service_name must not be empty")
+	}
+	return nil
+}
+
+// validEndpoint reports whether endpoint is empty or an absolute URL
+func validEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return endpoint == "" || (err == nil && u.Scheme != "" && u.Host != "")
+}
+
+// tracesURL is where spans are sent, or "" when tracing is off
+func (cfg Config) tracesURL() string {
+	if cfg.TracesEndpoint != "" {
+		return cfg.TracesEndpoint
+	}
+	if cfg.Endpoint != "" {
+		return strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// Tracer returns the backend's tracer from the global provider, so tests can
+// swap in an in-memory exporter with otel.SetTracerProvider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// Setup installs a tracer provider exporting over OTLP/HTTP to the configured
+// endpoint and the W3C trace context propagator. Tracing stays disabled
+// without an endpoint. The exporter's other settings, such as headers, still
+// come from the standard OTEL_* variables. The returned function flushes and
+// stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	endpoint := cfg.tracesURL()
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Inject serializes the span context in ctx as a W3C traceparent header
+// value, or returns "" if ctx carries no sampled span.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Extract parses a traceparent value written by Inject.
+func Extract(traceparent string) trace.SpanContext {
+	if traceparent == "" {
+		return trace.SpanContext{}
+	}
+	carrier := propagation.MapCarrier{"traceparent": traceparent}
+	return trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+}
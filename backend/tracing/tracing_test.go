@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a fresh SQLite database holding the given models. It is
+// closed when the test ends.
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// useRecorder routes spans to an in-memory exporter for the rest of the test.
+func useRecorder(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func TestMiddlewareAndGormPlugin(t *testing.T) {
+	exporter := useRecorder(t)
+
+	type item struct{ ID uint }
+	db := newTestDB(t, &item{})
+	if err := db.Use(GormPlugin{}); err != nil {
+		t.Fatalf("Use(GormPlugin) error = %v", err)
+	}
+	// Statements outside any trace get no spans
+	db.Find(&[]item{})
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("untraced statements recorded spans: %v", spans)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/items/:id", func(c *gin.Context) {
+		var found item
+		if err := db.WithContext(c.Request.Context()).First(&found, c.Param("id")).Error; err != nil {
+			c.Status(404)
+			return
+		}
+		c.Status(200)
+	})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/items/7", nil)
+	req.Header.Set("traceparent", traceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	server := findSpan(spans, "GET /items/:id")
+	query := findSpan(spans, "gorm.query")
+	if server == nil || query == nil {
+		t.Fatalf("spans = %v, want the request and its query", spans)
+	}
+	if server.SpanKind != trace.SpanKindServer || server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("server span did not continue the caller's trace: %+v", server.SpanContext)
+	}
+	if query.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("query span parent = %v, want the request span", query.Parent.SpanID())
+	}
+	if query.Status.Code != 0 {
+		t.Errorf("a missing record marked the query span as failed: %v", query.Status)
+	}
+}
+
+func TestConfigTracesURL(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{}, ""},
+		{Config{Endpoint: "http://collector:4318/"}, "http://collector:4318/v1/traces"},
+		{Config{Endpoint: "http://collector:4318", TracesEndpoint: "https://traces.example/otlp"}, "https://traces.example/otlp"},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.tracesURL(); got != tt.want {
+			t.Errorf("%+v.tracesURL() = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	useRecorder(t)
+
+	if got := Inject(context.Background()); got != "" {
+		t.Errorf("Inject() without a span = %q, want empty", got)
+	}
+
+	ctx, span := Tracer().Start(context.Background(), "request")
+	defer span.End()
+	extracted := Extract(Inject(ctx))
+	if !extracted.IsValid() || extracted.TraceID() != span.SpanContext().TraceID() || extracted.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("Extract(Inject()) = %+v, want %+v", extracted, span.SpanContext())
+	}
+	if Extract("garbage").IsValid() {
+		t.Error("Extract() accepted an invalid traceparent")
+	}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+)
+
+// RecordAudit appends an audit log entry for a mutation made by the request's
+// API key. details, if not nil, is stored as JSON. Failures are logged rather
+// than returned, as the mutation itself has already happened. The IP is the
+// client's as seen through the router's trusted proxies.
+func RecordAudit(c *gin.Context, db *gorm.DB, action models.AuditAction, targetType string, targetIDs []uint, details interface{}) {
+	entry := models.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetIDs:  targetIDs,
+		IP:         c.ClientIP(),
+	}
+	if key := CurrentAPIKey(c); key != nil {
+		entry.WorkspaceID = key.WorkspaceID
+		entry.APIKeyID = key.ID
+		entry.Actor = key.Name
+		entry.ActorPrefix = key.Prefix
+	}
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("Failed to encode audit details", "action", action, "error", err)
+		} else {
+			entry.Details = data
+		}
+	}
+
+	if err := db.WithContext(c.Request.Context()).Create(&entry).Error; err != nil {
+		logging.FromContext(c.Request.Context()).Error("Failed to record audit log entry", "action", action, "error", err)
+	}
+}
+
+// auditLogTriggers are created by EnsureAuditLogTriggers, by name
+var auditLogTriggers = map[string]string{
+	"audit_logs_no_update": "UPDATE",
+	"audit_logs_no_delete": "DELETE",
+}
+
+// EnsureAuditLogTriggers makes the database reject updates and deletes of
+// audit log entries. The model's hooks only stop GORM's Update and Delete;
+// UpdateColumn, Exec and raw SQL bypass them. Anyone allowed to drop
+// triggers can still get around these.
+func EnsureAuditLogTriggers(db *gorm.DB) error {
+	message := models.ErrAuditLogAppendOnly.Error()
+	for name, event := range auditLogTriggers {
+		var statement string
+		switch dialect := db.Dialector.Name(); dialect {
+		case "mysql":
+			// MySQL 8.0 before 8.0.29 lacks CREATE TRIGGER IF NOT EXISTS
+			var count int64
+			if err := db.Raw("SELECT COUNT(*) FROM information_schema.triggers WHERE trigger_schema = DATABASE() AND trigger_name = ?", name).
+				Scan(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			statement = fmt.Sprintf("CREATE TRIGGER %s BEFORE %s ON audit_logs FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = '%s'",
+				name, event, message)
+		case "sqlite":
+			statement = fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s BEFORE %s ON audit_logs BEGIN SELECT RAISE(ABORT, '%s'); END",
+				name, event, message)
+		default:
+			return fmt.Errorf("audit log triggers are not supported on %s", dialect)
+		}
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create trigger %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+)
+
+func TestRecordAudit(t *testing.T) {
+	db := newTestDB(t, &models.AuditLog{})
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("DELETE", "/api/urls", nil)
+	c.Request.RemoteAddr = "203.0.113.7:51234"
+	c.Set(ContextAPIKey, &models.APIKey{ID: 4, WorkspaceID: 2, Name: "reporting", Prefix: "sk_abcd1234"})
+
+	RecordAudit(c, db, models.AuditURLDelete, "url", []uint{3, 15}, map[string]int{"requested": 3})
+
+	var entry models.AuditLog
+	if err := db.First(&entry).Error; err != nil {
+		t.Fatalf("no audit entry recorded: %v", err)
+	}
+	if entry.WorkspaceID != 2 || entry.APIKeyID != 4 || entry.Actor != "reporting" || entry.IP != "203.0.113.7" {
+		t.Errorf("entry = %+v, want actor reporting (key 4, workspace 2) from 203.0.113.7", entry)
+	}
+	if len(entry.TargetIDs) != 2 || entry.TargetIDs[1] != 15 {
+		t.Errorf("target IDs = %v, want [3 15]", entry.TargetIDs)
+	}
+	if string(entry.Details) != `{"requested":3}` {
+		t.Errorf("details = %s", entry.Details)
+	}
+
+	// Single IDs are matched without hitting e.g. 150
+	var count int64
+	db.Model(&models.AuditLog{}).Where("target_ids LIKE ?", "%,15,%").Count(&count)
+	if count != 1 {
+		t.Errorf("entries targeting 15 = %d, want 1", count)
+	}
+	db.Model(&models.AuditLog{}).Where("target_ids LIKE ?", "%,1,%").Count(&count)
+	if count != 0 {
+		t.Errorf("entries targeting 1 = %d, want 0", count)
+	}
+
+	if err := db.Model(&entry).Update("action", "url.create").Error; !errors.Is(err, models.ErrAuditLogAppendOnly) {
+		t.Errorf("Update() error = %v, want ErrAuditLogAppendOnly", err)
+	}
+	if err := db.Delete(&entry).Error; !errors.Is(err, models.ErrAuditLogAppendOnly) {
+		t.Errorf("Delete() error = %v, want ErrAuditLogAppendOnly", err)
+	}
+
+	// Writes that skip the hooks are stopped by the triggers
+	for i := 0; i < 2; i++ {
+		if err := EnsureAuditLogTriggers(db); err != nil {
+			t.Fatalf("EnsureAuditLogTriggers() error = %v", err)
+		}
+	}
+	if err := db.Model(&entry).UpdateColumn("action", "url.create").Error; err == nil {
+		t.Error("UpdateColumn() succeeded on an audit log entry")
+	}
+	if err := db.Exec("DELETE FROM audit_logs").Error; err == nil {
+		t.Error("raw DELETE succeeded on the audit log")
+	}
+	db.Model(&models.AuditLog{}).Count(&count)
+	if count != 1 {
+		t.Errorf("entries = %d after blocked writes, want 1", count)
+	}
+}
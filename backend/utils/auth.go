@@ -1,18 +1,132 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/logging"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
 )
 
 const (
-	// Hardcoded Bearer token for API authentication
-	API_TOKEN = "sykell-api-token-2025"
+	// APIKeyPrefix starts every generated key so leaked keys are easy to spot
+	APIKeyPrefix = "sk_"
+	// ContextAPIKey is the Gin context key holding the caller's *models.APIKey
+	ContextAPIKey = "api_key"
+	// lastUsedResolution limits how often a key's last_used_at is written
+	lastUsedResolution = time.Minute
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// GenerateAPIKey returns a new random key along with its display prefix and
+// the hash to store.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + hex.EncodeToString(buf)
+	return key, key[:len(APIKeyPrefix)+8], HashAPIKey(key), nil
+}
+
+// HashAPIKey is the stored form of a key. Keys are long and random, so a fast
+// hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+const (
+	// BootstrapKeySetting is the setting EnsureBootstrapKey's key comes from
+	BootstrapKeySetting = "ADMIN_API_KEY"
+	// FrontendKeySetting is the setting EnsureFrontendKey's key comes from
+	FrontendKeySetting = "FRONTEND_API_KEY"
+	bootstrapKeyName   = "bootstrap admin"
+)
+
+// FrontendScopes are what the web frontend's key may do: work with URLs, but
+// not manage keys, webhooks or workspaces.
+var FrontendScopes = []models.Scope{models.ScopeURLsRead, models.ScopeURLsWrite, models.ScopeURLsDelete}
+
+// EnsureBootstrapKey makes sure key, typically taken from ADMIN_API_KEY, is
+// an admin key so the first real keys can be created. A previous bootstrap
+// key is revoked, so rotating ADMIN_API_KEY retires the old value.
+func EnsureBootstrapKey(db *gorm.DB, key string) error {
+	return ensureManagedKey(db, BootstrapKeySetting, bootstrapKeyName, key, []models.Scope{models.ScopeAdmin})
+}
+
+// EnsureFrontendKey makes sure key, taken from FRONTEND_API_KEY, is a key
+// with FrontendScopes for the web frontend, revoking the previous one.
+func EnsureFrontendKey(db *gorm.DB, key string) error {
+	return ensureManagedKey(db, FrontendKeySetting, "frontend", key, FrontendScopes)
+}
+
+// ensureManagedKey makes key the only unrevoked key from setting, with
+// exactly scopes.
+func ensureManagedKey(db *gorm.DB, setting, name, key string, scopes []models.Scope) error {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	scopeList := strings.Join(names, ",")
+	hash := HashAPIKey(key)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Bootstrap keys from before Managed was recorded are known by name
+		previous := tx.Model(&models.APIKey{}).Where("managed = ?", setting)
+		if setting == BootstrapKeySetting {
+			previous = tx.Model(&models.APIKey{}).Where("managed = ? OR (managed = '' AND name = ?)", setting, bootstrapKeyName)
+		}
+		if err := previous.Where("hash <> ? AND revoked_at IS NULL", hash).UpdateColumn("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var existing models.APIKey
+		err := tx.Where("hash = ?", hash).First(&existing).Error
+		if err == nil {
+			if existing.Scopes == scopeList && existing.Managed == setting {
+				return nil
+			}
+			return tx.Model(&existing).Updates(map[string]interface{}{"scopes": scopeList, "managed": setting}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		prefix := key
+		if len(prefix) > 8 {
+			prefix = prefix[:8]
+		}
+		return tx.Create(&models.APIKey{
+			WorkspaceID: models.DefaultWorkspaceID,
+			Name:        name,
+			Prefix:      prefix,
+			Hash:        hash,
+			Scopes:      scopeList,
+			Managed:     setting,
+		}).Error
+	})
+}
+
+// CurrentAPIKey returns the key that authenticated the request, or nil.
+func CurrentAPIKey(c *gin.Context) *models.APIKey {
+	if value, ok := c.Get(ContextAPIKey); ok {
+		if key, ok := value.(*models.APIKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// AuthMiddleware accepts requests carrying a valid, unexpired and unrevoked
+// API key as a Bearer token and stores the key in the context.
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -29,13 +143,87 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token := parts[1]
-		if token != API_TOKEN {
+		var key models.APIKey
+		if err := db.WithContext(c.Request.Context()).Where("hash = ?", HashAPIKey(parts[1])).First(&key).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
+		authorize(c, db, &key)
+	}
+}
+
+// StreamAuthMiddleware is AuthMiddleware for event streams. Browsers can't
+// set headers on EventSource requests, so it also accepts a ticket from
+// tickets as the ticket query parameter.
+func StreamAuthMiddleware(db *gorm.DB, tickets *StreamTickets) gin.HandlerFunc {
+	bearer := AuthMiddleware(db)
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			bearer(c)
+			return
+		}
+
+		keyID, ok := tickets.Redeem(ticket)
+		var key models.APIKey
+		if !ok || db.WithContext(c.Request.Context()).First(&key, keyID).Error != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream ticket"})
+			c.Abort()
+			return
+		}
+		authorize(c, db, &key)
+	}
+}
+
+// authorize lets the request through if key is neither revoked nor expired
+// and stores it in the context.
+func authorize(c *gin.Context, db *gorm.DB, key *models.APIKey) {
+	now := time.Now()
+	if key.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		c.Abort()
+		return
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
+		c.Abort()
+		return
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		db.WithContext(c.Request.Context()).Model(&models.APIKey{}).Where("id = ?", key.ID).UpdateColumn("last_used_at", now)
+		key.LastUsedAt = &now
+	}
+
+	c.Set(ContextAPIKey, key)
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx).With("api_key_id", key.ID, "workspace_id", key.WorkspaceID)
+	c.Request = c.Request.WithContext(logging.WithLogger(ctx, logger))
+	c.Next()
+}
 
+// CurrentWorkspaceID returns the workspace of the request's API key.
+func CurrentWorkspaceID(c *gin.Context) uint {
+	if key := CurrentAPIKey(c); key != nil {
+		return key.WorkspaceID
+	}
+	return 0
+}
+
+// RequireScope rejects requests whose API key lacks scope. It must run after
+// AuthMiddleware.
+func RequireScope(scope models.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := CurrentAPIKey(c)
+		if key == nil || !key.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "Missing required scope: " + string(scope),
+				"required_scope": scope,
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	db := newTestDB(t, &models.APIKey{})
+
+	newKey := func(name string, expiresAt, revokedAt *time.Time) string {
+		key, prefix, hash, err := GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey() error = %v", err)
+		}
+		db.Create(&models.APIKey{Name: name, Prefix: prefix, Hash: hash, ExpiresAt: expiresAt, RevokedAt: revokedAt})
+		return key
+	}
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	valid := newKey("valid", &future, nil)
+	expired := newKey("expired", &past, nil)
+	revoked := newKey("revoked", nil, &past)
+	if err := EnsureBootstrapKey(db, "bootstrap-secret"); err != nil {
+		t.Fatalf("EnsureBootstrapKey() error = %v", err)
+	}
+	if err := EnsureBootstrapKey(db, "bootstrap-secret"); err != nil {
+		t.Fatalf("second EnsureBootstrapKey() error = %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthMiddleware(db))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, CurrentAPIKey(c).Name)
+	})
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+		wantBody string
+	}{
+		{"valid key", "Bearer " + valid, http.StatusOK, "valid"},
+		{"bootstrap key", "Bearer bootstrap-secret", http.StatusOK, "bootstrap admin"},
+		{"missing header", "", http.StatusUnauthorized, ""},
+		{"wrong scheme", "Basic " + valid, http.StatusUnauthorized, ""},
+		{"unknown key", "Bearer sk_unknown", http.StatusUnauthorized, ""},
+		{"expired key", "Bearer " + expired, http.StatusUnauthorized, ""},
+		{"revoked key", "Bearer " + revoked, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	var key models.APIKey
+	db.Where("name = ?", "valid").First(&key)
+	if key.LastUsedAt == nil {
+		t.Error("last_used_at was not recorded")
+	}
+	var bootstrap []models.APIKey
+	db.Where("name = ?", "bootstrap admin").Find(&bootstrap)
+	if len(bootstrap) != 1 {
+		t.Fatalf("bootstrap keys = %d, want 1", len(bootstrap))
+	}
+	if !bootstrap[0].HasScope(models.ScopeAdmin) {
+		t.Errorf("bootstrap key scopes = %q, want admin", bootstrap[0].Scopes)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		scopes   string
+		required models.Scope
+		wantCode int
+	}{
+		{"granted scope", "urls:read,urls:write", models.ScopeURLsWrite, http.StatusOK},
+		{"missing scope", "urls:read", models.ScopeURLsDelete, http.StatusForbidden},
+		{"admin implies all", "admin", models.ScopeURLsDelete, http.StatusOK},
+		{"admin not implied", "urls:read,urls:write,urls:delete", models.ScopeAdmin, http.StatusForbidden},
+		{"no scopes", "", models.ScopeURLsRead, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				c.Set(ContextAPIKey, &models.APIKey{Scopes: tt.scopes})
+			}, RequireScope(tt.required), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusForbidden && !strings.Contains(rec.Body.String(), string(tt.required)) {
+				t.Errorf("body = %s, want it to name scope %s", rec.Body.String(), tt.required)
+			}
+		})
+	}
+}
+
+func TestStreamAuthMiddleware(t *testing.T) {
+	db := newTestDB(t, &models.APIKey{})
+	past := time.Now().Add(-time.Hour)
+	key := models.APIKey{Name: "reader", Prefix: "sk_test", Hash: HashAPIKey("sk_test")}
+	revoked := models.APIKey{Name: "revoked", Prefix: "sk_old", Hash: HashAPIKey("sk_old"), RevokedAt: &past}
+	db.Create(&key)
+	db.Create(&revoked)
+
+	tickets := NewStreamTickets()
+	issue := func(keyID uint) string {
+		ticket, _, err := tickets.Issue(keyID)
+		if err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+		return ticket
+	}
+	ticket := issue(key.ID)
+	expired := issue(key.ID)
+	// Only expired's lifetime is up when it is used
+	tickets.tickets[HashAPIKey(expired)] = streamTicket{keyID: key.ID, expiresAt: past}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/events", StreamAuthMiddleware(db, tickets), func(c *gin.Context) {
+		c.String(http.StatusOK, CurrentAPIKey(c).Name)
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		header   string
+		wantCode int
+	}{
+		{"ticket", "?ticket=" + ticket, "", http.StatusOK},
+		{"used ticket", "?ticket=" + ticket, "", http.StatusUnauthorized},
+		{"expired ticket", "?ticket=" + expired, "", http.StatusUnauthorized},
+		{"revoked key's ticket", "?ticket=" + issue(revoked.ID), "", http.StatusUnauthorized},
+		{"api key in the URL", "?ticket=sk_test", "", http.StatusUnauthorized},
+		{"bearer header", "", "Bearer sk_test", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/events"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestEnsureManagedKeysRevokeRotatedValues(t *testing.T) {
+	db := newTestDB(t, &models.APIKey{})
+	// A bootstrap key from before managed keys were recorded
+	db.Create(&models.APIKey{Name: "bootstrap admin", Prefix: "legacy", Hash: HashAPIKey("legacy-secret"), Scopes: "admin"})
+
+	for _, key := range []string{"admin-secret-1", "admin-secret-2"} {
+		if err := EnsureBootstrapKey(db, key); err != nil {
+			t.Fatalf("EnsureBootstrapKey(%q) error = %v", key, err)
+		}
+	}
+	for _, key := range []string{"frontend-secret-1", "frontend-secret-2"} {
+		if err := EnsureFrontendKey(db, key); err != nil {
+			t.Fatalf("EnsureFrontendKey(%q) error = %v", key, err)
+		}
+	}
+
+	tests := []struct {
+		key         string
+		wantRevoked bool
+		wantScopes  string
+	}{
+		{"legacy-secret", true, "admin"},
+		{"admin-secret-1", true, "admin"},
+		{"admin-secret-2", false, "admin"},
+		{"frontend-secret-1", true, "urls:read,urls:write,urls:delete"},
+		{"frontend-secret-2", false, "urls:read,urls:write,urls:delete"},
+	}
+	for _, tt := range tests {
+		var key models.APIKey
+		if err := db.Where("hash = ?", HashAPIKey(tt.key)).First(&key).Error; err != nil {
+			t.Fatalf("key %q: %v", tt.key, err)
+		}
+		if (key.RevokedAt != nil) != tt.wantRevoked {
+			t.Errorf("key %q revoked = %v, want %v", tt.key, key.RevokedAt != nil, tt.wantRevoked)
+		}
+		if key.Scopes != tt.wantScopes {
+			t.Errorf("key %q scopes = %q, want %q", tt.key, key.Scopes, tt.wantScopes)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSMiddleware lets browsers on the allowed origins call the API and answers
+// their preflight requests. An origin of "*" allows any.
+func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
+	allowAny := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		if allowAny {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			// Responses differ per origin, so caches must keep them apart
+			c.Writer.Header().Add("Vary", "Origin")
+			if origin := c.GetHeader("Origin"); allowed[origin] {
+				c.Header("Access-Control-Allow-Origin", origin)
+			}
+		}
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Request-ID")
+		// Browser clients need the rate limit headers to back off
+		c.Header("Access-Control-Expose-Headers", "X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, "+
+			"X-RateLimit-Analyses-Limit, X-RateLimit-Analyses-Remaining, X-RateLimit-Analyses-Reset, Retry-After")
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
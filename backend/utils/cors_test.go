@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    string
+	}{
+		{"any origin", []string{"*"}, "https://evil.example", "*"},
+		{"listed origin", []string{"https://app.example/"}, "https://app.example", "https://app.example"},
+		{"unlisted origin", []string{"https://app.example"}, "https://evil.example", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(CORSMiddleware(tt.allowed))
+			r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest("OPTIONS", "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusNoContent {
+				t.Errorf("preflight status = %d, want 204", w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "PATCH") {
+				t.Errorf("Access-Control-Allow-Methods = %q, want PATCH among them", got)
+			}
+			if got := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "X-RateLimit-Analyses-Remaining") ||
+				!strings.Contains(got, "Retry-After") {
+				t.Errorf("Access-Control-Expose-Headers = %q, want the rate limit headers among them", got)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,54 +10,238 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sykell/backend/metrics"
 	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/html"
 )
 
 type CrawlerService struct {
-	client *http.Client
+	config  CrawlerConfig
+	client  *http.Client
+	robots  *RobotsChecker
+	limiter *HostLimiter
 }
 
-const MaxCheckedLinks = 10
+// CrawlerConfig tunes the crawler's outbound requests.
+type CrawlerConfig struct {
+	// FetchTimeout bounds each page download
+	FetchTimeout time.Duration `yaml:"fetch_timeout"`
+	// LinkCheckTimeout bounds each link check once it is allowed to start
+	LinkCheckTimeout time.Duration `yaml:"link_check_timeout"`
+	// RobotsTimeout bounds each robots.txt download
+	RobotsTimeout time.Duration `yaml:"robots_timeout"`
+	// MaxCheckedLinks is how many links per page are checked for breakage
+	MaxCheckedLinks int `yaml:"max_checked_links"`
+	// UserAgent is sent with every outbound request
+	UserAgent string `yaml:"user_agent"`
+	// MaxConnsPerHost and HostRequestsPerSecond limit the load put on one host
+	MaxConnsPerHost       int     `yaml:"max_conns_per_host"`
+	HostRequestsPerSecond float64 `yaml:"host_requests_per_second"`
+}
 
-func NewCrawlerService() *CrawlerService {
-	return &CrawlerService{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-			// Don't follow redirects automatically to avoid redirect loops
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) >= 10 {
-					return fmt.Errorf("too many redirects")
-				}
-				return nil
-			},
+// DefaultUserAgent is sent unless the configuration says otherwise
+const DefaultUserAgent = "Mozilla/5.0 (compatible; SykellBot/1.0)"
+
+// DefaultCrawlerConfig returns the settings used when nothing is configured.
+func DefaultCrawlerConfig() CrawlerConfig {
+	return CrawlerConfig{
+		FetchTimeout:          10 * time.Second,
+		LinkCheckTimeout:      5 * time.Second,
+		RobotsTimeout:         5 * time.Second,
+		MaxCheckedLinks:       10,
+		UserAgent:             DefaultUserAgent,
+		MaxConnsPerHost:       DefaultMaxConnsPerHost,
+		HostRequestsPerSecond: DefaultHostRequestsPerSecond,
+	}
+}
+
+// Validate reports the first setting the crawler cannot work with.
+func (cfg CrawlerConfig) Validate() error {
+	switch {
+	case cfg.FetchTimeout <= 0:
+		return errors.New("fetch_timeout must be positive")
+	case cfg.LinkCheckTimeout <= 0:
+		return errors.New("link_check_timeout must be positive")
+	case cfg.RobotsTimeout <= 0:
+		return errors.New("robots_timeout must be positive")
+	case cfg.MaxCheckedLinks < 0:
+		return errors.New("max_checked_links must not be negative")
+	case strings.TrimSpace(cfg.UserAgent) == "":
+		return errors.New("user_agent must not be empty")
+	case cfg.MaxConnsPerHost < 1:
+		return errors.New("max_conns_per_host must be at least 1")
+	case cfg.HostRequestsPerSecond < 0:
+		return errors.New("host_requests_per_second must not be negative")
+	}
+	return nil
+}
+
+// CrawlOptions tune a single analysis.
+type CrawlOptions struct {
+	// IgnoreRobots skips robots.txt checks and Crawl-delay
+	IgnoreRobots bool
+	// MaxDepth and MaxPages bound a site crawl
+	MaxDepth int
+	MaxPages int
+	// Progress, if set, is called as the analysis moves from stage to stage
+	Progress func(CrawlProgress)
+}
+
+type CrawlStage string
+
+const (
+	StageFetching      CrawlStage = "fetching"
+	StageCheckingLinks CrawlStage = "checking_links"
+)
+
+// CrawlProgress describes what an analysis is doing right now.
+type CrawlProgress struct {
+	Stage CrawlStage `json:"stage"`
+	Page  string     `json:"page"`
+	// PagesCrawled counts pages finished so far; MaxPages is 1 outside site crawls
+	PagesCrawled int `json:"pages_crawled"`
+	MaxPages     int `json:"max_pages"`
+	// LinksToCheck is set while checking links
+	LinksToCheck int `json:"links_to_check,omitempty"`
+}
+
+func (o CrawlOptions) report(progress CrawlProgress) {
+	if o.Progress != nil {
+		o.Progress(progress)
+	}
+}
+
+func NewCrawlerService(cfg CrawlerConfig) *CrawlerService {
+	client := &http.Client{
+		Timeout: cfg.FetchTimeout,
+		// Don't follow redirects automatically to avoid redirect loops
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("too many redirects")
+			}
+			return nil
 		},
 	}
+	c := &CrawlerService{
+		config:  cfg,
+		client:  client,
+		limiter: NewHostLimiter(cfg.MaxConnsPerHost, cfg.HostRequestsPerSecond),
+	}
+	c.robots = NewRobotsChecker(func(req *http.Request) (*http.Response, error) {
+		return c.do(req, cfg.RobotsTimeout)
+	})
+	return c
 }
 
-func (c *CrawlerService) AnalyzeURL(targetURL string) (*models.AnalysisResult, []models.BrokenLink, error) {
-	// Fetch the HTML content
-	resp, err := c.client.Get(targetURL)
+// do sends req with the configured User-Agent once the per-host limiter lets
+// it through. timeout, if set, only starts counting after that wait. A 429
+// response holds back every request to the host for its Retry-After and is
+// retried while that wait is no longer than MaxRetryAfter.
+func (c *CrawlerService) do(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	req.Header.Set("User-Agent", c.config.UserAgent)
+	host := req.URL.Host
+	for attempt := 0; ; attempt++ {
+		release, err := c.limiter.Acquire(req.Context(), host)
+		if err != nil {
+			return nil, err
+		}
+
+		attemptReq, cancel := req, context.CancelFunc(func() {})
+		if timeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(req.Context(), timeout)
+			attemptReq = req.WithContext(ctx)
+		}
+		done := func() {
+			cancel()
+			release()
+		}
+
+		resp, err := c.client.Do(attemptReq)
+		recordFetch(resp, err)
+		if err != nil {
+			done()
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: done}
+			return resp, nil
+		}
+
+		wait, ok := parseRetryAfter(resp.Header, time.Now())
+		if !ok {
+			wait = time.Second << attempt
+		}
+		backoff := wait
+		if backoff > MaxRetryAfter {
+			backoff = MaxRetryAfter
+		}
+		c.limiter.Backoff(host, time.Now().Add(backoff))
+		if attempt >= Max429Retries || wait > MaxRetryAfter {
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: done}
+			return resp, nil
+		}
+		resp.Body.Close()
+		done()
+	}
+}
+
+func (c *CrawlerService) AnalyzeURL(ctx context.Context, targetURL string, opts CrawlOptions) (*models.AnalysisResult, []models.BrokenLink, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "crawler.AnalyzeURL", trace.WithAttributes(semconv.URLFull(targetURL)))
+	defer span.End()
+
+	opts.report(CrawlProgress{Stage: StageFetching, Page: targetURL, MaxPages: 1})
+	result, _, allLinks, err := c.analyzePage(ctx, targetURL, opts)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch URL: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// Check for broken links (limited to the first few)
+	links := allLinks[:min(len(allLinks), c.config.MaxCheckedLinks)]
+	opts.report(CrawlProgress{Stage: StageCheckingLinks, Page: targetURL, MaxPages: 1, LinksToCheck: len(links)})
+	brokenLinks := c.checkBrokenLinks(ctx, links, opts)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	result.BrokenLinks, result.DisallowedLinks = countLinkOutcomes(brokenLinks)
+	result.CheckedLinks = append([]string{}, links...)
+
+	return result, brokenLinks, nil
+}
+
+// analyzePage fetches and analyzes a single page without checking its links.
+// It returns the page's internal links and all of its links alongside the result.
+func (c *CrawlerService) analyzePage(ctx context.Context, targetURL string, opts CrawlOptions) (*models.AnalysisResult, []string, []string, error) {
+	if err := c.waitForRobots(ctx, targetURL, opts); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Fetch the HTML content
+	body, err := c.fetchPage(ctx, targetURL)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, nil, nil, err
 	}
 
 	// Parse HTML
+	_, parseSpan := tracing.Tracer().Start(ctx, "crawler.parse_html", trace.WithAttributes(attribute.Int("html.bytes", len(body))))
+	defer parseSpan.End()
 	doc, err := html.Parse(strings.NewReader(string(body)))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse HTML: %w", err)
+		parseSpan.SetStatus(codes.Error, err.Error())
+		return nil, nil, nil, fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
 	// Extract base URL for relative link resolution
 	baseURL, err := url.Parse(targetURL)
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid base URL: %w", err)
+		return nil, nil, nil, fmt.Errorf("invalid base URL: %w", err)
 	}
 
 	// Analyze the HTML
@@ -84,11 +269,34 @@ func (c *CrawlerService) AnalyzeURL(targetURL string) (*models.AnalysisResult, [
 	result.InternalLinks = len(internalLinks)
 	result.ExternalLinks = len(externalLinks)
 	
-	// Check for broken links (limit to first 10)
-	brokenLinks := c.checkBrokenLinks(allLinks[:min(len(allLinks), MaxCheckedLinks)])
-	result.BrokenLinks = len(brokenLinks)
+	return result, internalLinks, allLinks, nil
+}
 
-	return result, brokenLinks, nil
+// fetchPage downloads the page body.
+func (c *CrawlerService) fetchPage(ctx context.Context, targetURL string) ([]byte, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "crawler.fetch_page", trace.WithAttributes(semconv.URLFull(targetURL)))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	resp, err := c.do(req, 0)
+	if err != nil {
+		span.SetStatus(codes.Error, c.sanitizeErrorMessage(err.Error()))
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	span.SetAttributes(attribute.Int("http.response.body.size", len(body)))
+	return body, nil
 }
 
 // Add a generic traverseHTML function
@@ -185,42 +393,104 @@ func extractLinks(doc *html.Node, baseURL *url.URL) ([]string, []string, []strin
 	return internalLinks, externalLinks, allLinks
 }
 
-func (c *CrawlerService) checkBrokenLinks(links []string) []models.BrokenLink {
+// waitForRobots returns ErrDisallowedByRobots if robots.txt forbids fetching
+// link, and otherwise waits out the host's Crawl-delay.
+func (c *CrawlerService) waitForRobots(ctx context.Context, link string, opts CrawlOptions) error {
+	if opts.IgnoreRobots {
+		return nil
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		// Let the request itself report the malformed URL
+		return nil
+	}
+	if !c.robots.Allowed(ctx, parsed) {
+		return ErrDisallowedByRobots
+	}
+	return c.robots.Wait(ctx, parsed)
+}
+
+func countLinkOutcomes(links []models.BrokenLink) (broken, disallowed int) {
+	for _, link := range links {
+		switch models.LinkOutcome(link.Outcome) {
+		case models.LinkBroken:
+			broken++
+		case models.LinkDisallowed:
+			disallowed++
+		}
+	}
+	return broken, disallowed
+}
+
+func (c *CrawlerService) checkBrokenLinks(ctx context.Context, links []string, opts CrawlOptions) []models.BrokenLink {
+	ctx, span := tracing.Tracer().Start(ctx, "crawler.check_links", trace.WithAttributes(attribute.Int("links.count", len(links))))
+	defer span.End()
+
 	var brokenLinks []models.BrokenLink
 	
 	for _, link := range links {
+		// Stop early if the analysis was cancelled
+		if ctx.Err() != nil {
+			break
+		}
+
 		// Validate URL format first
 		if !isValidURL(link) {
 			brokenLinks = append(brokenLinks, models.BrokenLink{
 				URL:          link,
 				StatusCode:   0,
 				ErrorMessage: "Invalid URL format",
+				Outcome:      string(models.LinkBroken),
 			})
 			continue
 		}
 
+		// Respect robots.txt, reporting disallowed links separately from broken ones
+		if err := c.waitForRobots(ctx, link, opts); err != nil {
+			if errors.Is(err, ErrDisallowedByRobots) {
+				brokenLinks = append(brokenLinks, models.BrokenLink{
+					URL:          link,
+					StatusCode:   0,
+					ErrorMessage: "Disallowed by robots.txt",
+					Outcome:      string(models.LinkDisallowed),
+				})
+				continue
+			}
+			break
+		}
+
 		// Try HEAD request first, fallback to GET if needed
-		statusCode, err := c.checkLinkWithHEAD(link)
+		start := time.Now()
+		statusCode, err := c.checkLinkWithHEAD(ctx, link)
 		if err != nil {
 			// If HEAD fails with 405, try GET
 			if strings.Contains(err.Error(), "405") {
-				statusCode, err = c.checkLinkWithGET(link)
+				statusCode, err = c.checkLinkWithGET(ctx, link)
 			}
 		}
+		metrics.ObserveLinkCheck(linkCheckResult(statusCode, err), time.Since(start))
 
 		if err != nil {
 			brokenLinks = append(brokenLinks, models.BrokenLink{
 				URL:          link,
 				StatusCode:   0,
 				ErrorMessage: c.sanitizeErrorMessage(err.Error()),
+				Outcome:      string(models.LinkBroken),
 			})
 			continue
 		}
 
 		// Consider 4xx and 5xx as broken, but handle some edge cases
 		if statusCode >= 400 {
-			// Don't mark rate limiting as broken (429)
+			// Still rate limited after honoring Retry-After, which says
+			// nothing about whether the link works
 			if statusCode == 429 {
+				brokenLinks = append(brokenLinks, models.BrokenLink{
+					URL:          link,
+					StatusCode:   statusCode,
+					ErrorMessage: getStatusMessage(statusCode),
+					Outcome:      string(models.LinkRateLimited),
+				})
 				continue
 			}
 			// Don't mark authentication required as broken (401, 407)
@@ -232,6 +502,7 @@ func (c *CrawlerService) checkBrokenLinks(links []string) []models.BrokenLink {
 				URL:          link,
 				StatusCode:   statusCode,
 				ErrorMessage: getStatusMessage(statusCode),
+				Outcome:      string(models.LinkBroken),
 			})
 		}
 	}
@@ -239,20 +510,18 @@ func (c *CrawlerService) checkBrokenLinks(links []string) []models.BrokenLink {
 	return brokenLinks
 }
 
-func (c *CrawlerService) checkLinkWithHEAD(link string) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
+func (c *CrawlerService) checkLinkWithHEAD(ctx context.Context, link string) (statusCode int, err error) {
+	ctx, span := startLinkCheckSpan(ctx, "HEAD", link)
+	defer func() { endLinkCheckSpan(span, statusCode, err) }()
+
 	req, err := http.NewRequestWithContext(ctx, "HEAD", link, nil)
 	if err != nil {
 		return 0, err
 	}
 	
-	// Set a realistic user agent to avoid blocking
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; SykellBot/1.0)")
 	req.Header.Set("Accept", "*/*")
 	
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req, c.config.LinkCheckTimeout)
 	if err != nil {
 		return 0, err
 	}
@@ -261,20 +530,18 @@ func (c *CrawlerService) checkLinkWithHEAD(link string) (int, error) {
 	return resp.StatusCode, nil
 }
 
-func (c *CrawlerService) checkLinkWithGET(link string) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
+func (c *CrawlerService) checkLinkWithGET(ctx context.Context, link string) (statusCode int, err error) {
+	ctx, span := startLinkCheckSpan(ctx, "GET", link)
+	defer func() { endLinkCheckSpan(span, statusCode, err) }()
+
 	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
 	if err != nil {
 		return 0, err
 	}
 	
-	// Set a realistic user agent to avoid blocking
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; SykellBot/1.0)")
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
 	
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req, c.config.LinkCheckTimeout)
 	if err != nil {
 		return 0, err
 	}
@@ -283,6 +550,23 @@ func (c *CrawlerService) checkLinkWithGET(link string) (int, error) {
 	return resp.StatusCode, nil
 }
 
+func startLinkCheckSpan(ctx context.Context, method, link string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "crawler.check_link "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(method), semconv.URLFull(link)),
+	)
+}
+
+func endLinkCheckSpan(span trace.Span, statusCode int, err error) {
+	if err != nil {
+		span.SetAttributes(attribute.String("error.type", classifyFetchError(err.Error())))
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+	}
+	span.End()
+}
+
 func isValidURL(link string) bool {
 	parsed, err := url.Parse(link)
 	if err != nil {
@@ -291,24 +575,71 @@ func isValidURL(link string) bool {
 	return parsed.Scheme != "" && parsed.Host != ""
 }
 
+// Fetch error types, used both for user-facing messages and as metric labels
+const (
+	FetchErrorTLS              = "tls"
+	FetchErrorDNS              = "dns"
+	FetchErrorTimeout          = "timeout"
+	FetchErrorConnRefused      = "connection_refused"
+	FetchErrorTooManyRedirects = "too_many_redirects"
+	FetchErrorOther            = "other"
+)
+
+var fetchErrorMessages = map[string]string{
+	FetchErrorTLS:              "SSL/TLS certificate error",
+	FetchErrorDNS:              "DNS resolution failed",
+	FetchErrorTimeout:          "Request timeout",
+	FetchErrorConnRefused:      "Connection refused",
+	FetchErrorTooManyRedirects: "Too many redirects",
+}
+
+// classifyFetchError sorts an outbound request error into a fetch error type.
+func classifyFetchError(errMsg string) string {
+	switch {
+	case strings.Contains(errMsg, "x509"):
+		return FetchErrorTLS
+	case strings.Contains(errMsg, "no such host"):
+		return FetchErrorDNS
+	case strings.Contains(errMsg, "timeout"):
+		return FetchErrorTimeout
+	case strings.Contains(errMsg, "connection refused"):
+		return FetchErrorConnRefused
+	case strings.Contains(errMsg, "too many redirects"):
+		return FetchErrorTooManyRedirects
+	}
+	return FetchErrorOther
+}
+
 func (c *CrawlerService) sanitizeErrorMessage(errMsg string) string {
 	// Remove sensitive information from error messages
-	if strings.Contains(errMsg, "x509") {
-		return "SSL/TLS certificate error"
+	if msg, ok := fetchErrorMessages[classifyFetchError(errMsg)]; ok {
+		return msg
 	}
-	if strings.Contains(errMsg, "no such host") {
-		return "DNS resolution failed"
-	}
-	if strings.Contains(errMsg, "timeout") {
-		return "Request timeout"
-	}
-	if strings.Contains(errMsg, "connection refused") {
-		return "Connection refused"
+	return errMsg
+}
+
+// recordFetch counts one outbound request attempt by its status class, or by
+// error type if it failed.
+func recordFetch(resp *http.Response, err error) {
+	if err != nil {
+		metrics.ObserveFetch("error", classifyFetchError(err.Error()))
+		return
 	}
-	if strings.Contains(errMsg, "too many redirects") {
-		return "Too many redirects"
+	metrics.ObserveFetch(fmt.Sprintf("%dxx", resp.StatusCode/100), "none")
+}
+
+// linkCheckResult labels a link check for metrics the way checkBrokenLinks
+// classifies it.
+func linkCheckResult(statusCode int, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case statusCode == 429:
+		return "rate_limited"
+	case statusCode == 401 || statusCode == 407 || statusCode < 400:
+		return "ok"
 	}
-	return errMsg
+	return "broken"
 }
 
 func getStatusMessage(statusCode int) string {
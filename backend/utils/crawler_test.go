@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -224,6 +228,33 @@ func TestGetStatusMessage(t *testing.T) {
 	}
 }
 
+func TestSanitizeErrorMessage(t *testing.T) {
+	c := NewCrawlerService(DefaultCrawlerConfig())
+	tests := []struct {
+		err      string
+		wantType string
+		wantMsg  string
+	}{
+		{`Head "https://a.test": x509: certificate signed by unknown authority`, FetchErrorTLS, "SSL/TLS certificate error"},
+		{`dial tcp: lookup a.test: no such host`, FetchErrorDNS, "DNS resolution failed"},
+		{`read tcp 10.0.0.1:443: i/o timeout`, FetchErrorTimeout, "Request timeout"},
+		{`dial tcp 127.0.0.1:9: connect: connection refused`, FetchErrorConnRefused, "Connection refused"},
+		{`stopped after 10 redirects: too many redirects`, FetchErrorTooManyRedirects, "Too many redirects"},
+		{`unsupported protocol scheme "ftp"`, FetchErrorOther, `unsupported protocol scheme "ftp"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantType, func(t *testing.T) {
+			if got := classifyFetchError(tt.err); got != tt.wantType {
+				t.Errorf("classifyFetchError() = %q, want %q", got, tt.wantType)
+			}
+			if got := c.sanitizeErrorMessage(tt.err); got != tt.wantMsg {
+				t.Errorf("sanitizeErrorMessage() = %q, want %q", got, tt.wantMsg)
+			}
+		})
+	}
+}
+
 func TestMin(t *testing.T) {
 	tests := []struct {
 		a, b, expected int
@@ -243,4 +274,19 @@ func TestMin(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestAnalyzeURLCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head><title>Test</title></head><body></body></html>")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := newTestCrawler().AnalyzeURL(ctx, server.URL, CrawlOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("AnalyzeURL() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// mysqlDuplicateEntry is MySQL's ER_DUP_ENTRY error number
+const mysqlDuplicateEntry = 1062
+
+// IsDuplicateKey reports whether err is a unique constraint violation, as
+// opposed to any other database failure.
+func IsDuplicateKey(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+	// SQLite, used in tests, only reports it in the message
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a fresh SQLite database holding the given models. It is
+// closed when the test ends.
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	db := newTestDB(t, &models.URL{})
+
+	if err := db.Create(&models.URL{URL: "https://example.com"}).Error; err != nil {
+		t.Fatalf("Failed to create URL: %v", err)
+	}
+	if err := db.Create(&models.URL{URL: "https://example.com"}).Error; !IsDuplicateKey(err) {
+		t.Errorf("IsDuplicateKey(%v) = false for a repeated URL", err)
+	}
+	if IsDuplicateKey(errors.New("connection refused")) || IsDuplicateKey(nil) {
+		t.Error("IsDuplicateKey() = true for an unrelated error")
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"sort"
+
+	"github.com/sykell/backend/models"
+)
+
+// DiffAnalyses compares two runs of the same URL. Broken links are matched by
+// URL and only links with the broken outcome take part. Only the first few
+// links of a page are checked, so links missing from either run's
+// CheckedLinks are left out rather than reported as newly fixed or broken.
+// Runs without CheckedLinks, made before it was recorded, count as having
+// checked every link.
+func DiffAnalyses(from, to models.AnalysisResult, fromLinks, toLinks []models.BrokenLink) models.AnalysisDiff {
+	diff := models.AnalysisDiff{
+		URLID:       to.URLID,
+		From:        models.AnalysisRef{ID: from.ID, Version: from.Version, CreatedAt: from.CreatedAt},
+		To:          models.AnalysisRef{ID: to.ID, Version: to.Version, CreatedAt: to.CreatedAt},
+		Title:       textChange(from.Title, to.Title),
+		HTMLVersion: textChange(from.HTMLVersion, to.HTMLVersion),
+		Headings: map[string]models.CountDelta{
+			"h1": countDelta(from.H1Count, to.H1Count),
+			"h2": countDelta(from.H2Count, to.H2Count),
+			"h3": countDelta(from.H3Count, to.H3Count),
+			"h4": countDelta(from.H4Count, to.H4Count),
+			"h5": countDelta(from.H5Count, to.H5Count),
+			"h6": countDelta(from.H6Count, to.H6Count),
+		},
+		InternalLinks: countDelta(from.InternalLinks, to.InternalLinks),
+		ExternalLinks: countDelta(from.ExternalLinks, to.ExternalLinks),
+		BrokenLinks:   countDelta(from.BrokenLinks, to.BrokenLinks),
+		NewlyBroken:   []models.BrokenLink{},
+		NewlyFixed:    []models.BrokenLink{},
+		LoginForm: models.LoginFormChange{
+			From:   from.HasLoginForm,
+			To:     to.HasLoginForm,
+			Change: "unchanged",
+		},
+	}
+
+	if !from.HasLoginForm && to.HasLoginForm {
+		diff.LoginForm.Change = "appeared"
+	} else if from.HasLoginForm && !to.HasLoginForm {
+		diff.LoginForm.Change = "disappeared"
+	}
+
+	checkedBefore, checkedAfter := checkedSet(from.CheckedLinks), checkedSet(to.CheckedLinks)
+	checkedInBoth := func(url string) bool {
+		return (checkedBefore == nil || checkedBefore[url]) && (checkedAfter == nil || checkedAfter[url])
+	}
+
+	before := brokenByURL(fromLinks)
+	after := brokenByURL(toLinks)
+	for url, link := range after {
+		if _, ok := before[url]; !ok && checkedInBoth(url) {
+			diff.NewlyBroken = append(diff.NewlyBroken, link)
+		}
+	}
+	for url, link := range before {
+		if _, ok := after[url]; !ok && checkedInBoth(url) {
+			diff.NewlyFixed = append(diff.NewlyFixed, link)
+		}
+	}
+	sortLinks(diff.NewlyBroken)
+	sortLinks(diff.NewlyFixed)
+
+	return diff
+}
+
+func countDelta(from, to int) models.CountDelta {
+	return models.CountDelta{From: from, To: to, Delta: to - from}
+}
+
+func textChange(from, to string) models.TextChange {
+	return models.TextChange{Changed: from != to, From: from, To: to}
+}
+
+func brokenByURL(links []models.BrokenLink) map[string]models.BrokenLink {
+	byURL := make(map[string]models.BrokenLink, len(links))
+	for _, link := range links {
+		if link.Outcome == "" || link.Outcome == string(models.LinkBroken) {
+			byURL[link.URL] = link
+		}
+	}
+	return byURL
+}
+
+// checkedSet indexes a run's checked links; nil means not recorded.
+func checkedSet(links []string) map[string]bool {
+	if links == nil {
+		return nil
+	}
+	set := make(map[string]bool, len(links))
+	for _, link := range links {
+		set[link] = true
+	}
+	return set
+}
+
+func sortLinks(links []models.BrokenLink) {
+	sort.Slice(links, func(i, j int) bool { return links[i].URL < links[j].URL })
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/sykell/backend/models"
+)
+
+func TestDiffAnalyses(t *testing.T) {
+	from := models.AnalysisResult{ID: 1, Version: 1, URLID: 7, Title: "Old", HTMLVersion: "HTML5", H1Count: 2, H2Count: 1, InternalLinks: 10, ExternalLinks: 3, BrokenLinks: 2}
+	to := models.AnalysisResult{ID: 2, Version: 2, URLID: 7, Title: "New", HTMLVersion: "HTML5", H1Count: 1, H2Count: 1, InternalLinks: 12, ExternalLinks: 3, BrokenLinks: 2, HasLoginForm: true}
+	fromLinks := []models.BrokenLink{
+		{URL: "https://example.com/gone", StatusCode: 404, Outcome: "broken"},
+		{URL: "https://example.com/still", StatusCode: 500, Outcome: "broken"},
+		{URL: "https://example.com/robots", Outcome: "disallowed"},
+	}
+	toLinks := []models.BrokenLink{
+		{URL: "https://example.com/still", StatusCode: 500, Outcome: "broken"},
+		{URL: "https://example.com/new", StatusCode: 404, Outcome: "broken"},
+	}
+
+	diff := DiffAnalyses(from, to, fromLinks, toLinks)
+
+	if diff.URLID != 7 || diff.From.Version != 1 || diff.To.Version != 2 {
+		t.Errorf("refs = %d %+v %+v", diff.URLID, diff.From, diff.To)
+	}
+	if !diff.Title.Changed || diff.Title.From != "Old" || diff.Title.To != "New" {
+		t.Errorf("Title = %+v, want Old -> New", diff.Title)
+	}
+	if diff.HTMLVersion.Changed {
+		t.Errorf("HTMLVersion = %+v, want unchanged", diff.HTMLVersion)
+	}
+	if h1 := diff.Headings["h1"]; h1.Delta != -1 || h1.From != 2 || h1.To != 1 {
+		t.Errorf("h1 = %+v, want 2 -> 1", h1)
+	}
+	if diff.InternalLinks.Delta != 2 || diff.ExternalLinks.Delta != 0 {
+		t.Errorf("link deltas = %d/%d, want 2/0", diff.InternalLinks.Delta, diff.ExternalLinks.Delta)
+	}
+	if len(diff.NewlyBroken) != 1 || diff.NewlyBroken[0].URL != "https://example.com/new" {
+		t.Errorf("NewlyBroken = %+v", diff.NewlyBroken)
+	}
+	if len(diff.NewlyFixed) != 1 || diff.NewlyFixed[0].URL != "https://example.com/gone" {
+		t.Errorf("NewlyFixed = %+v", diff.NewlyFixed)
+	}
+	if diff.LoginForm.Change != "appeared" {
+		t.Errorf("LoginForm.Change = %q, want appeared", diff.LoginForm.Change)
+	}
+}
+
+func TestDiffAnalysesIgnoresLinksOutsideCheckedWindow(t *testing.T) {
+	from := models.AnalysisResult{CheckedLinks: []string{"https://example.com/a", "https://example.com/b"}}
+	to := models.AnalysisResult{CheckedLinks: []string{"https://example.com/b", "https://example.com/c"}}
+	fromLinks := []models.BrokenLink{
+		{URL: "https://example.com/a", StatusCode: 404, Outcome: "broken"},
+		{URL: "https://example.com/b", StatusCode: 404, Outcome: "broken"},
+	}
+	toLinks := []models.BrokenLink{
+		{URL: "https://example.com/c", StatusCode: 404, Outcome: "broken"},
+	}
+
+	diff := DiffAnalyses(from, to, fromLinks, toLinks)
+
+	// a left the window and c entered it, so only b has comparable statuses
+	if len(diff.NewlyBroken) != 0 {
+		t.Errorf("NewlyBroken = %+v, want none", diff.NewlyBroken)
+	}
+	if len(diff.NewlyFixed) != 1 || diff.NewlyFixed[0].URL != "https://example.com/b" {
+		t.Errorf("NewlyFixed = %+v, want only b", diff.NewlyFixed)
+	}
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxConnsPerHost is how many requests may be in flight to one host
+	DefaultMaxConnsPerHost = 2
+	// DefaultHostRequestsPerSecond is how many requests may start per host per second
+	DefaultHostRequestsPerSecond = 2.0
+	// MaxRetryAfter is the longest Retry-After we wait out before giving up on a request
+	MaxRetryAfter = 30 * time.Second
+	// Max429Retries is how many times a 429 response is retried
+	Max429Retries = 2
+	// pruneThreshold is the number of tracked hosts at which idle ones are forgotten
+	pruneThreshold = 1024
+)
+
+type hostState struct {
+	conns chan struct{}
+	next  time.Time
+}
+
+// HostLimiter bounds the concurrency and request rate of outbound requests
+// per host. It is shared by every fetch path of a CrawlerService so that
+// concurrent analyses hitting the same site coordinate with each other.
+type HostLimiter struct {
+	maxConns int
+	interval time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+func NewHostLimiter(maxConns int, requestsPerSecond float64) *HostLimiter {
+	if maxConns < 1 {
+		maxConns = 1
+	}
+	var interval time.Duration
+	if requestsPerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	return &HostLimiter{
+		maxConns: maxConns,
+		interval: interval,
+		hosts:    make(map[string]*hostState),
+	}
+}
+
+// Acquire waits for a free connection slot and for the host's rate limit,
+// then returns a release function that must be called once the request is
+// done with its connection.
+func (l *HostLimiter) Acquire(ctx context.Context, host string) (func(), error) {
+	state := l.state(host)
+
+	select {
+	case state.conns <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-state.conns }
+
+	// Reserve the next start time before sleeping so waiters queue up in order
+	l.mu.Lock()
+	start := time.Now()
+	if state.next.After(start) {
+		start = state.next
+	}
+	state.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	if err := sleepUntil(ctx, start); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// Backoff keeps new requests to host from starting before until.
+func (l *HostLimiter) Backoff(host string, until time.Time) {
+	state := l.state(host)
+
+	l.mu.Lock()
+	if until.After(state.next) {
+		state.next = until
+	}
+	l.mu.Unlock()
+}
+
+func (l *HostLimiter) state(host string) *hostState {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if state, ok := l.hosts[host]; ok {
+		return state
+	}
+	if len(l.hosts) >= pruneThreshold {
+		l.prune()
+	}
+	state := &hostState{conns: make(chan struct{}, l.maxConns)}
+	l.hosts[host] = state
+	return state
+}
+
+// prune forgets hosts with no requests in flight or pending. Callers hold l.mu.
+func (l *HostLimiter) prune() {
+	now := time.Now()
+	for host, state := range l.hosts {
+		if len(state.conns) == 0 && state.next.Before(now) {
+			delete(l.hosts, host)
+		}
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an
+// HTTP date. It returns false if the header is missing or malformed.
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// releaseOnClose frees a HostLimiter connection slot when the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCrawler returns a crawler without per-host rate limiting, since
+// every test server runs on the same host.
+func newTestCrawler() *CrawlerService {
+	c := NewCrawlerService(DefaultCrawlerConfig())
+	c.limiter = NewHostLimiter(DefaultMaxConnsPerHost, 0)
+	return c
+}
+
+func TestHostLimiterConcurrency(t *testing.T) {
+	limiter := NewHostLimiter(2, 0)
+
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := limiter.Acquire(context.Background(), "example.com")
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("peak concurrency = %d, want at most 2", peak)
+	}
+}
+
+func TestHostLimiterRate(t *testing.T) {
+	limiter := NewHostLimiter(10, 20)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.Acquire(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		release()
+	}
+	// Three requests at 20/s need two 50ms gaps
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests took %v, want at least 100ms", elapsed)
+	}
+
+	// Other hosts are not held back
+	start = time.Now()
+	release, _ := limiter.Acquire(context.Background(), "example.org")
+	release()
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("first request to another host took %v", elapsed)
+	}
+}
+
+func TestHostLimiterBackoffRespectsContext(t *testing.T) {
+	limiter := NewHostLimiter(1, 0)
+	limiter.Backoff("example.com", time.Now().Add(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, "example.com"); err == nil {
+		t.Error("Acquire() during backoff returned no error after the context expired")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		wait   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second, true},
+		{now.Add(-10 * time.Second).Format(http.TimeFormat), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			wait, ok := parseRetryAfter(header, now)
+			if wait != tt.wait || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, wait, ok, tt.wait, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDoRetriesTooManyRequests(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := newTestCrawler().do(req, time.Second)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("do() status = %d after %d calls, want 200 after 2", resp.StatusCode, calls)
+	}
+}
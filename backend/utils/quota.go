@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errQuotaExceeded = errors.New("daily analysis quota exceeded")
+
+// QuotaStatus reports how much of the tighter of a key's and its workspace's
+// daily analysis quotas is left.
+type QuotaStatus struct {
+	Allowed bool
+	// Limit is 0 when neither the key nor the workspace has a quota
+	Limit     int
+	Remaining int
+	// Reset is when the quota starts over, at the next UTC midnight
+	Reset time.Time
+}
+
+type quotaCounter struct {
+	scope   models.UsageScope
+	ownerID uint
+	limit   int
+}
+
+// ReserveAnalyses counts n analyses against the key's and its workspace's
+// daily quotas. If either would be exceeded nothing is counted and the
+// status is not Allowed.
+func ReserveAnalyses(db *gorm.DB, key *models.APIKey, n int, now time.Time) (QuotaStatus, error) {
+	return reserveAnalyses(db, key.WorkspaceID, n, now, quotaCounter{models.UsageScopeKey, key.ID, key.DailyAnalysisQuota})
+}
+
+// ReserveWorkspaceAnalyses counts n analyses against only the workspace's
+// daily quota, for analyses no key asked for, such as scheduled runs.
+func ReserveWorkspaceAnalyses(db *gorm.DB, workspaceID uint, n int, now time.Time) (QuotaStatus, error) {
+	return reserveAnalyses(db, workspaceID, n, now)
+}
+
+// reserveAnalyses counts n analyses against the workspace's quota and any
+// other counters, all or none of them.
+func reserveAnalyses(db *gorm.DB, workspaceID uint, n int, now time.Time, counters ...quotaCounter) (QuotaStatus, error) {
+	now = now.UTC()
+	day := now.Format("2006-01-02")
+	status := QuotaStatus{Reset: time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)}
+
+	var workspace models.Workspace
+	if err := db.Select("id", "daily_analysis_quota").First(&workspace, workspaceID).Error; err != nil {
+		return status, err
+	}
+	counters = append(counters, quotaCounter{models.UsageScopeWorkspace, workspaceID, workspace.DailyAnalysisQuota})
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, counter := range counters {
+			usage := models.AnalysisUsage{Scope: string(counter.scope), OwnerID: counter.ownerID, Day: day}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error; err != nil {
+				return err
+			}
+
+			// The limit is checked in the UPDATE itself so concurrent
+			// requests cannot both take the last analyses
+			update := tx.Model(&models.AnalysisUsage{}).
+				Where("scope = ? AND owner_id = ? AND day = ?", counter.scope, counter.ownerID, day)
+			if counter.limit > 0 {
+				update = update.Where("used + ? <= ?", n, counter.limit)
+			}
+			result := update.Update("used", gorm.Expr("used + ?", n))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errQuotaExceeded
+			}
+		}
+		return nil
+	})
+	status.Allowed = err == nil
+	if err != nil && !errors.Is(err, errQuotaExceeded) {
+		return status, err
+	}
+
+	for _, counter := range counters {
+		if counter.limit == 0 {
+			continue
+		}
+		var used int
+		if err := db.Model(&models.AnalysisUsage{}).
+			Where("scope = ? AND owner_id = ? AND day = ?", counter.scope, counter.ownerID, day).
+			Select("used").Scan(&used).Error; err != nil {
+			return status, err
+		}
+		remaining := max(counter.limit-used, 0)
+		if status.Limit == 0 || remaining < status.Remaining {
+			status.Limit, status.Remaining = counter.limit, remaining
+		}
+	}
+	return status, nil
+}
+
+// ReleaseAnalyses gives back n analyses reserved today that were not used,
+// e.g. because an import turned out to contain duplicates.
+func ReleaseAnalyses(db *gorm.DB, key *models.APIKey, n int, now time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+	day := now.UTC().Format("2006-01-02")
+	return db.Model(&models.AnalysisUsage{}).
+		Where("day = ? AND ((scope = ? AND owner_id = ?) OR (scope = ? AND owner_id = ?))",
+			day, models.UsageScopeKey, key.ID, models.UsageScopeWorkspace, key.WorkspaceID).
+		Update("used", gorm.Expr("CASE WHEN used > ? THEN used - ? ELSE 0 END", n, n)).Error
+}
+
+// ReleaseWorkspaceAnalyses gives back n analyses reserved today with
+// ReserveWorkspaceAnalyses.
+func ReleaseWorkspaceAnalyses(db *gorm.DB, workspaceID uint, n int, now time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+	day := now.UTC().Format("2006-01-02")
+	return db.Model(&models.AnalysisUsage{}).
+		Where("day = ? AND scope = ? AND owner_id = ?", day, models.UsageScopeWorkspace, workspaceID).
+		Update("used", gorm.Expr("CASE WHEN used > ? THEN used - ? ELSE 0 END", n, n)).Error
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sykell/backend/models"
+)
+
+func TestReserveAnalyses(t *testing.T) {
+	db := newTestDB(t, &models.Workspace{}, &models.AnalysisUsage{})
+	db.Create(&models.Workspace{ID: 1, Name: "Team", DailyAnalysisQuota: 5})
+
+	limited := &models.APIKey{ID: 1, WorkspaceID: 1, DailyAnalysisQuota: 3}
+	unlimited := &models.APIKey{ID: 2, WorkspaceID: 1}
+	now := time.Date(2024, 3, 1, 22, 0, 0, 0, time.UTC)
+
+	reserve := func(key *models.APIKey, n int) QuotaStatus {
+		t.Helper()
+		status, err := ReserveAnalyses(db, key, n, now)
+		if err != nil {
+			t.Fatalf("ReserveAnalyses() error = %v", err)
+		}
+		return status
+	}
+
+	if status := reserve(limited, 2); !status.Allowed || status.Limit != 3 || status.Remaining != 1 {
+		t.Errorf("first reservation = %+v, want allowed with 1 of 3 left", status)
+	}
+	if status := reserve(limited, 2); status.Allowed || status.Remaining != 1 {
+		t.Errorf("over the key quota = %+v, want refused with 1 left", status)
+	}
+	if status := reserve(unlimited, 2); !status.Allowed || status.Limit != 5 || status.Remaining != 1 {
+		t.Errorf("second key = %+v, want allowed with 1 of the workspace's 5 left", status)
+	}
+	if status := reserve(unlimited, 2); status.Allowed {
+		t.Errorf("over the workspace quota = %+v, want refused", status)
+	}
+	if status := reserve(limited, 1); !status.Allowed || status.Remaining != 0 {
+		t.Errorf("last analysis = %+v, want allowed with none left", status)
+	}
+
+	if err := ReleaseAnalyses(db, unlimited, 2, now); err != nil {
+		t.Fatalf("ReleaseAnalyses() error = %v", err)
+	}
+	if status := reserve(unlimited, 2); !status.Allowed {
+		t.Errorf("after release = %+v, want allowed", status)
+	}
+
+	// Quotas start over at midnight UTC
+	status := reserve(limited, 1)
+	if want := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC); !status.Reset.Equal(want) {
+		t.Errorf("Reset = %v, want %v", status.Reset, want)
+	}
+	now = now.Add(3 * time.Hour)
+	if status := reserve(limited, 3); !status.Allowed {
+		t.Errorf("next day = %+v, want allowed", status)
+	}
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultAPIRequestsPerSecond is how fast an API key's request budget refills
+	DefaultAPIRequestsPerSecond = 10.0
+	// DefaultAPIBurst is how many requests an idle API key may make at once
+	DefaultAPIBurst = 20
+	// bucketPruneThreshold is the number of tracked keys at which full
+	// buckets are forgotten
+	bucketPruneThreshold = 1024
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is an in-memory token bucket per API key.
+type RateLimiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[uint]*bucket
+}
+
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    requestsPerSecond,
+		burst:   burst,
+		now:     time.Now,
+		buckets: make(map[uint]*bucket),
+	}
+}
+
+// RateLimitResult describes a key's bucket after a call to Allow.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Allow takes a token from the key's bucket if one is available.
+func (l *RateLimiter) Allow(key uint) RateLimitResult {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= bucketPruneThreshold {
+			l.prune(now)
+		}
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	result := RateLimitResult{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.refillTime(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = l.refillTime(float64(l.burst) - b.tokens)
+	return result
+}
+
+func (l *RateLimiter) refillTime(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// prune forgets keys whose buckets have refilled completely. Callers hold l.mu.
+func (l *RateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitMiddleware limits requests per API key and reports the key's
+// budget in X-RateLimit-* headers. It must run after AuthMiddleware.
+func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := CurrentAPIKey(c)
+		if key == nil || limiter.rate <= 0 {
+			c.Next()
+			return
+		}
+
+		result := limiter.Allow(key.ID)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sykell/backend/models"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if result := limiter.Allow(1); !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i+1, result, 2-i)
+		}
+	}
+	result := limiter.Allow(1)
+	if result.Allowed {
+		t.Fatal("fourth request in a burst of 3 was allowed")
+	}
+	if result.RetryAfter != 500*time.Millisecond || result.Reset != 1500*time.Millisecond {
+		t.Errorf("RetryAfter = %v, Reset = %v, want 500ms and 1.5s", result.RetryAfter, result.Reset)
+	}
+
+	// Other keys have their own bucket
+	if !limiter.Allow(2).Allowed {
+		t.Error("a different key was limited")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !limiter.Allow(1).Allowed {
+		t.Error("request after refill was not allowed")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(ContextAPIKey, &models.APIKey{ID: 1})
+	}, RateLimitMiddleware(NewRateLimiter(0.5, 1)))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	first := httptest.NewRecorder()
+	r.ServeHTTP(first, httptest.NewRequest("GET", "/", nil))
+	if first.Code != http.StatusOK || first.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("first request = %d with remaining %q, want 200 with 0", first.Code, first.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	second := httptest.NewRecorder()
+	r.ServeHTTP(second, httptest.NewRequest("GET", "/", nil))
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", second.Code)
+	}
+	if got := second.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	if got := second.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("X-RateLimit-Limit = %q, want 1", got)
+	}
+}
@@ -0,0 +1,326 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RobotsUserAgent is the product token matched against robots.txt groups
+	RobotsUserAgent = "SykellBot"
+	// RobotsCacheTTL is how long a host's robots.txt is reused before refetching
+	RobotsCacheTTL = time.Hour
+	// MaxRobotsCacheHosts bounds the cache; the least recently used host goes first
+	MaxRobotsCacheHosts = 10000
+	// MaxCrawlDelay caps the Crawl-delay we are willing to honor per request
+	MaxCrawlDelay = 10 * time.Second
+	// maxRobotsSize is the most of a robots.txt file we read, as in RFC 9309
+	maxRobotsSize = 500 * 1024
+)
+
+// ErrDisallowedByRobots is returned when robots.txt forbids fetching a URL.
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// RobotsRules are the robots.txt rules that apply to our user agent on one host.
+type RobotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// allowAll and disallowAll stand in for missing or unreachable robots.txt files
+var (
+	allowAll    = &RobotsRules{}
+	disallowAll = &RobotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}
+)
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// ParseRobots parses a robots.txt body and keeps the rules for userAgent,
+// falling back to the "*" group when no group names it.
+func ParseRobots(body io.Reader, userAgent string) *RobotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	inAgentLines := false
+
+	scanner := bufio.NewScanner(io.LimitReader(body, maxRobotsSize))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share one group
+			if current == nil || !inAgentLines {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgentLines = true
+		case "allow", "disallow":
+			inAgentLines = false
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgentLines = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	agent := strings.ToLower(userAgent)
+	var matched, wildcard []*robotsGroup
+	for _, group := range groups {
+		for _, a := range group.agents {
+			if a == "*" {
+				wildcard = append(wildcard, group)
+				break
+			}
+			if a != "" && strings.HasPrefix(agent, a) {
+				matched = append(matched, group)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		matched = wildcard
+	}
+
+	rules := &RobotsRules{}
+	for _, group := range matched {
+		rules.rules = append(rules.rules, group.rules...)
+		if group.crawlDelay > rules.crawlDelay {
+			rules.crawlDelay = group.crawlDelay
+		}
+	}
+	return rules
+}
+
+// Allowed reports whether the path (including any query) may be fetched.
+// The longest matching rule wins and Allow wins ties.
+func (r *RobotsRules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay is the delay the host asks for between requests.
+func (r *RobotsRules) CrawlDelay() time.Duration {
+	return r.crawlDelay
+}
+
+// matchRobotsPattern matches a robots.txt path pattern, which may use "*" as
+// a wildcard and end in "$" to anchor it to the end of the path.
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return !anchored || pos == len(path)
+}
+
+type robotsEntry struct {
+	rules     *RobotsRules
+	fetchedAt time.Time
+	lastUsed  time.Time
+	lastHit   time.Time
+}
+
+// RobotsChecker fetches and caches robots.txt per host and spaces out
+// requests to each host according to its Crawl-delay.
+type RobotsChecker struct {
+	do       func(*http.Request) (*http.Response, error)
+	maxHosts int
+	mu       sync.Mutex
+	hosts    map[string]*robotsEntry
+}
+
+// NewRobotsChecker creates a checker that fetches robots.txt files with do.
+func NewRobotsChecker(do func(*http.Request) (*http.Response, error)) *RobotsChecker {
+	return &RobotsChecker{
+		do:       do,
+		maxHosts: MaxRobotsCacheHosts,
+		hosts:    make(map[string]*robotsEntry),
+	}
+}
+
+// Allowed reports whether robots.txt permits fetching link.
+func (rc *RobotsChecker) Allowed(ctx context.Context, link *url.URL) bool {
+	path := link.EscapedPath()
+	if link.RawQuery != "" {
+		path += "?" + link.RawQuery
+	}
+	return rc.rulesFor(ctx, link).Allowed(path)
+}
+
+// Wait blocks until the host's Crawl-delay has passed since the previous
+// request to it, then records the new request.
+func (rc *RobotsChecker) Wait(ctx context.Context, link *url.URL) error {
+	delay := rc.rulesFor(ctx, link).CrawlDelay()
+	if delay > MaxCrawlDelay {
+		delay = MaxCrawlDelay
+	}
+
+	key := robotsKey(link)
+	rc.mu.Lock()
+	now := time.Now()
+	entry, ok := rc.hosts[key]
+	if !ok {
+		// Evicted since rulesFor; a zero fetch time makes the next call refetch
+		rc.evict(now)
+		entry = &robotsEntry{rules: allowAll, lastUsed: now}
+		rc.hosts[key] = entry
+	}
+	next := entry.lastHit.Add(delay)
+	if next.Before(now) {
+		next = now
+	}
+	// Reserve the slot before sleeping so concurrent callers queue up behind us
+	entry.lastHit = next
+	rc.mu.Unlock()
+
+	return sleepUntil(ctx, next)
+}
+
+func (rc *RobotsChecker) rulesFor(ctx context.Context, link *url.URL) *RobotsRules {
+	key := robotsKey(link)
+
+	rc.mu.Lock()
+	if entry, ok := rc.hosts[key]; ok && time.Since(entry.fetchedAt) < RobotsCacheTTL {
+		entry.lastUsed = time.Now()
+		rules := entry.rules
+		rc.mu.Unlock()
+		return rules
+	}
+	rc.mu.Unlock()
+
+	rules := rc.fetch(ctx, link)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	if existing, ok := rc.hosts[key]; ok {
+		existing.rules = rules
+		existing.fetchedAt = now
+		existing.lastUsed = now
+		return rules
+	}
+	rc.evict(now)
+	rc.hosts[key] = &robotsEntry{rules: rules, fetchedAt: now, lastUsed: now}
+	return rules
+}
+
+// evict makes room for one more host once the cache is full. Expired entries
+// whose Crawl-delay slot has passed go first, then the least recently used
+// one. Callers hold rc.mu.
+func (rc *RobotsChecker) evict(now time.Time) {
+	if len(rc.hosts) < rc.maxHosts {
+		return
+	}
+
+	oldestKey := ""
+	var oldest time.Time
+	for key, entry := range rc.hosts {
+		if now.Sub(entry.fetchedAt) >= RobotsCacheTTL && !entry.lastHit.After(now) {
+			delete(rc.hosts, key)
+			continue
+		}
+		if oldestKey == "" || entry.lastUsed.Before(oldest) {
+			oldestKey, oldest = key, entry.lastUsed
+		}
+	}
+	if len(rc.hosts) >= rc.maxHosts && oldestKey != "" {
+		delete(rc.hosts, oldestKey)
+	}
+}
+
+// fetch downloads robots.txt for the link's host. Per RFC 9309 a missing file
+// allows everything and a server error disallows everything. Network errors
+// allow everything so the real request can report what went wrong.
+func (rc *RobotsChecker) fetch(ctx context.Context, link *url.URL) *RobotsRules {
+	robotsURL := url.URL{Scheme: link.Scheme, Host: link.Host, Path: "/robots.txt"}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL.String(), nil)
+	if err != nil {
+		return allowAll
+	}
+	resp, err := rc.do(req)
+	if err != nil {
+		return allowAll
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll
+	case resp.StatusCode >= 400:
+		return allowAll
+	case resp.StatusCode >= 300:
+		// The client already followed redirects, so this is a redirect loop
+		return allowAll
+	}
+	return ParseRobots(resp.Body, RobotsUserAgent)
+}
+
+func robotsKey(link *url.URL) string {
+	return strings.ToLower(link.Scheme + "://" + link.Host)
+}
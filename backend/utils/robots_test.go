@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sykell/backend/models"
+)
+
+const testRobots = `
+# Comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 1
+
+User-agent: OtherBot
+Disallow: /
+
+User-agent: sykellbot
+User-agent: AnotherBot
+Disallow: /admin
+Disallow: /*.pdf$
+Allow: /admin/help
+Crawl-delay: 0.5
+`
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		{"specific group allows unlisted path", "SykellBot", "/private", true},
+		{"specific group disallows prefix", "SykellBot", "/admin/users", false},
+		{"longer allow wins", "SykellBot", "/admin/help", true},
+		{"anchored wildcard matches", "SykellBot", "/docs/file.pdf", false},
+		{"anchored wildcard needs end", "SykellBot", "/docs/file.pdf?x=1", true},
+		{"robots.txt always allowed", "OtherBot", "/robots.txt", true},
+		{"disallow all", "OtherBot", "/anything", false},
+		{"wildcard group fallback", "UnknownBot", "/private/x", false},
+		{"wildcard group allow", "UnknownBot", "/private/public/x", true},
+		{"root allowed", "UnknownBot", "/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := ParseRobots(strings.NewReader(testRobots), tt.userAgent)
+			if got := rules.Allowed(tt.path); got != tt.expected {
+				t.Errorf("Allowed(%q) for %s = %v, want %v", tt.path, tt.userAgent, got, tt.expected)
+			}
+		})
+	}
+
+	if got := ParseRobots(strings.NewReader(testRobots), "SykellBot").CrawlDelay(); got != 500*time.Millisecond {
+		t.Errorf("CrawlDelay() = %v, want 500ms", got)
+	}
+}
+
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*.php", "/index.php?x=1", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			if got := matchRobotsPattern(tt.pattern, tt.path); got != tt.expected {
+				t.Errorf("matchRobotsPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAnalyzeURLHonorsRobots(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /secret\n")
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/secret/page">Secret</a><a href="/missing">Missing</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	crawler := newTestCrawler()
+
+	result, links, err := crawler.AnalyzeURL(context.Background(), server.URL+"/", CrawlOptions{})
+	if err != nil {
+		t.Fatalf("AnalyzeURL() error = %v", err)
+	}
+	if result.BrokenLinks != 1 || result.DisallowedLinks != 1 {
+		t.Errorf("AnalyzeURL() broken/disallowed = %d/%d, want 1/1", result.BrokenLinks, result.DisallowedLinks)
+	}
+	for _, link := range links {
+		if strings.HasSuffix(link.URL, "/secret/page") && link.Outcome != string(models.LinkDisallowed) {
+			t.Errorf("outcome for %s = %q, want %q", link.URL, link.Outcome, models.LinkDisallowed)
+		}
+	}
+
+	_, _, err = crawler.AnalyzeURL(context.Background(), server.URL+"/secret/page", CrawlOptions{})
+	if !errors.Is(err, ErrDisallowedByRobots) {
+		t.Errorf("AnalyzeURL() on disallowed page error = %v, want ErrDisallowedByRobots", err)
+	}
+
+	_, _, err = crawler.AnalyzeURL(context.Background(), server.URL+"/secret/page", CrawlOptions{IgnoreRobots: true})
+	if errors.Is(err, ErrDisallowedByRobots) {
+		t.Error("AnalyzeURL() with IgnoreRobots still blocked by robots.txt")
+	}
+}
+
+func TestRobotsCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	fetches := make(map[string]int)
+	rc := NewRobotsChecker(func(req *http.Request) (*http.Response, error) {
+		fetches[req.URL.Host]++
+		return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+	})
+	rc.maxHosts = 2
+
+	visit := func(host string) {
+		link, _ := url.Parse("https://" + host + "/")
+		rc.Allowed(context.Background(), link)
+	}
+	visit("a.example")
+	visit("b.example")
+	visit("a.example")
+	visit("c.example") // evicts b, the least recently used
+	visit("a.example")
+	visit("b.example")
+
+	if len(rc.hosts) > 2 {
+		t.Errorf("cache holds %d hosts, want at most 2", len(rc.hosts))
+	}
+	if fetches["a.example"] != 1 || fetches["b.example"] != 2 {
+		t.Errorf("fetches = %v, want a.example once and b.example twice", fetches)
+	}
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// MinScheduleInterval is the shortest gap allowed between scheduled runs
+	MinScheduleInterval = 15 * time.Minute
+	// MaxScheduleLength matches the size of the schedule column
+	MaxScheduleLength = 64
+)
+
+// Schedule yields the run times of a recurring analysis.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule accepts either a five-field cron expression ("0 6 * * *"), a
+// descriptor such as "@daily" or "@every 12h", or a bare interval ("24h").
+// Cron expressions are evaluated in UTC unless prefixed with CRON_TZ=.
+// Schedules that fire more often than MinScheduleInterval are rejected.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("schedule is empty")
+	}
+	if len(spec) > MaxScheduleLength {
+		return nil, fmt.Errorf("schedule is longer than %d characters", MaxScheduleLength)
+	}
+
+	var schedule Schedule
+	if interval, err := time.ParseDuration(spec); err == nil {
+		if interval < MinScheduleInterval {
+			return nil, fmt.Errorf("interval must be at least %s", MinScheduleInterval)
+		}
+		schedule = cron.Every(interval)
+	} else {
+		parsed, err := cronParser.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule: %w", err)
+		}
+		// The server's local zone is arbitrary; a CRON_TZ= prefix still wins
+		if spec, ok := parsed.(*cron.SpecSchedule); ok && spec.Location == time.Local {
+			spec.Location = time.UTC
+		}
+		schedule = parsed
+	}
+
+	// Check the gap between a few consecutive runs to catch expressions like
+	// "* * * * *" that fire every minute
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := schedule.Next(start)
+	if prev.IsZero() {
+		return nil, errors.New("schedule never fires")
+	}
+	for i := 0; i < 24; i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(prev) < MinScheduleInterval {
+			return nil, fmt.Errorf("schedule must not run more often than every %s", MinScheduleInterval)
+		}
+		prev = next
+	}
+	return schedule, nil
+}
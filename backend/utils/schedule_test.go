@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2025, 3, 10, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		wantErr  bool
+		wantNext time.Time
+	}{
+		{spec: "24h", wantNext: start.Add(24 * time.Hour)},
+		{spec: "@every 12h", wantNext: start.Add(12 * time.Hour)},
+		{spec: "0 6 * * *", wantNext: time.Date(2025, 3, 11, 6, 0, 0, 0, time.UTC)},
+		{spec: "@daily", wantNext: time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{spec: "", wantErr: true},
+		{spec: "5m", wantErr: true},
+		{spec: "* * * * *", wantErr: true},
+		{spec: "*/5 9 * * 1", wantErr: true},
+		{spec: "not a schedule", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSchedule(%q) expected error", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) error = %v", tt.spec, err)
+			}
+			if got := schedule.Next(start); !got.Equal(tt.wantNext) {
+				t.Errorf("Next() = %v, want %v", got, tt.wantNext)
+			}
+		})
+	}
+}
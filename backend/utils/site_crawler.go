@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/sykell/backend/models"
+	"github.com/sykell/backend/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultCrawlDepth = 2
+	DefaultCrawlPages = 20
+)
+
+// PageAnalysis is the analysis of one page visited during a site crawl.
+type PageAnalysis struct {
+	URL         string
+	Depth       int
+	Result      *models.AnalysisResult
+	BrokenLinks []models.BrokenLink
+}
+
+// Links to these file types are never followed during a site crawl
+var nonDocumentExtensions = map[string]bool{
+	".pdf": true, ".zip": true, ".gz": true, ".tar": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true, ".webp": true, ".ico": true,
+	".mp3": true, ".mp4": true, ".avi": true, ".mov": true, ".webm": true,
+	".css": true, ".js": true, ".json": true, ".xml": true, ".txt": true,
+	".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+}
+
+// CrawlSite analyzes rootURL and then follows its internal links breadth-first,
+// up to opts.MaxDepth levels below the root and at most opts.MaxPages pages in
+// total. Each link is checked at most once per crawl. Pages other than the
+// root that fail to load are skipped.
+func (c *CrawlerService) CrawlSite(ctx context.Context, rootURL string, opts CrawlOptions) ([]PageAnalysis, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "crawler.CrawlSite", trace.WithAttributes(semconv.URLFull(rootURL)))
+	defer span.End()
+
+	root, err := url.Parse(rootURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	maxDepth, maxPages := opts.MaxDepth, opts.MaxPages
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+	if maxPages < 1 {
+		maxPages = 1
+	}
+
+	type queuedPage struct {
+		url   string
+		depth int
+	}
+
+	var pages []PageAnalysis
+	visited := map[string]bool{normalizePageURL(root): true}
+	queue := []queuedPage{{url: rootURL, depth: 0}}
+	checked := make(map[string]*models.BrokenLink)
+
+	for len(queue) > 0 && len(pages) < maxPages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		page := queue[0]
+		queue = queue[1:]
+
+		progress := CrawlProgress{Stage: StageFetching, Page: page.url, PagesCrawled: len(pages), MaxPages: maxPages}
+		opts.report(progress)
+		result, internalLinks, allLinks, err := c.analyzePage(ctx, page.url, opts)
+		if err != nil {
+			if page.depth == 0 {
+				return nil, err
+			}
+			continue
+		}
+
+		links := allLinks[:min(len(allLinks), c.config.MaxCheckedLinks)]
+		progress.Stage, progress.LinksToCheck = StageCheckingLinks, len(links)
+		opts.report(progress)
+		brokenLinks := c.checkLinksOnce(ctx, links, checked, opts)
+		result.BrokenLinks, result.DisallowedLinks = countLinkOutcomes(brokenLinks)
+		result.CheckedLinks = append([]string{}, links...)
+		pages = append(pages, PageAnalysis{
+			URL:         page.url,
+			Depth:       page.depth,
+			Result:      result,
+			BrokenLinks: brokenLinks,
+		})
+
+		if page.depth >= maxDepth {
+			continue
+		}
+		for _, link := range internalLinks {
+			parsed, err := url.Parse(link)
+			if err != nil || !isCrawlable(parsed, root) {
+				continue
+			}
+			key := normalizePageURL(parsed)
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			queue = append(queue, queuedPage{url: link, depth: page.depth + 1})
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// checkLinksOnce checks the links not yet present in checked and records the
+// outcome there, so a link shared by many pages is only requested once.
+func (c *CrawlerService) checkLinksOnce(ctx context.Context, links []string, checked map[string]*models.BrokenLink, opts CrawlOptions) []models.BrokenLink {
+	var unchecked []string
+	for _, link := range links {
+		if _, ok := checked[link]; !ok {
+			unchecked = append(unchecked, link)
+		}
+	}
+
+	broken := make(map[string]models.BrokenLink)
+	for _, b := range c.checkBrokenLinks(ctx, unchecked, opts) {
+		broken[b.URL] = b
+	}
+	for _, link := range unchecked {
+		if b, ok := broken[link]; ok {
+			checked[link] = &b
+		} else if ctx.Err() == nil {
+			checked[link] = nil
+		}
+	}
+
+	var brokenLinks []models.BrokenLink
+	for _, link := range links {
+		if b := checked[link]; b != nil {
+			brokenLinks = append(brokenLinks, *b)
+		}
+	}
+	return brokenLinks
+}
+
+// AggregateCrawl sums the per-page counts of a site crawl into a single
+// result. The title and HTML version are taken from the root page.
+func AggregateCrawl(pages []PageAnalysis) *models.AnalysisResult {
+	total := &models.AnalysisResult{PagesCrawled: len(pages)}
+	if len(pages) == 0 {
+		return total
+	}
+
+	total.Title = pages[0].Result.Title
+	total.HTMLVersion = pages[0].Result.HTMLVersion
+	for _, page := range pages {
+		r := page.Result
+		total.H1Count += r.H1Count
+		total.H2Count += r.H2Count
+		total.H3Count += r.H3Count
+		total.H4Count += r.H4Count
+		total.H5Count += r.H5Count
+		total.H6Count += r.H6Count
+		total.InternalLinks += r.InternalLinks
+		total.ExternalLinks += r.ExternalLinks
+		total.BrokenLinks += r.BrokenLinks
+		total.DisallowedLinks += r.DisallowedLinks
+		total.HasLoginForm = total.HasLoginForm || r.HasLoginForm
+	}
+	return total
+}
+
+// isCrawlable reports whether link is an HTTP(S) page on the same host as root.
+func isCrawlable(link, root *url.URL) bool {
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return false
+	}
+	if !strings.EqualFold(link.Host, root.Host) {
+		return false
+	}
+	return !nonDocumentExtensions[strings.ToLower(path.Ext(link.Path))]
+}
+
+// normalizePageURL drops the fragment and trailing slash so the same page
+// isn't visited twice under slightly different URLs.
+func normalizePageURL(u *url.URL) string {
+	n := *u
+	n.Fragment = ""
+	n.Host = strings.ToLower(n.Host)
+	n.Path = strings.TrimSuffix(n.Path, "/")
+	return n.String()
+}
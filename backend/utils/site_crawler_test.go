@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sykell/backend/models"
+)
+
+func newSiteServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	pages := map[string]string{
+		"/":  `<html><head><title>Home</title></head><body><h1>Home</h1><a href="/a">A</a><a href="/b#top">B</a><a href="/file.pdf">PDF</a></body></html>`,
+		"/a": `<html><head><title>A</title></head><body><h1>A</h1><a href="/">Home</a><a href="/c">C</a></body></html>`,
+		"/b": `<html><head><title>B</title></head><body><h2>B</h2><input type="password"></body></html>`,
+		"/c": `<html><head><title>C</title></head><body><h1>C</h1></body></html>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCrawlSite(t *testing.T) {
+	server := newSiteServer(t)
+	crawler := newTestCrawler()
+
+	tests := []struct {
+		name      string
+		maxDepth  int
+		maxPages  int
+		wantPages []string
+	}{
+		{"root only", 0, 10, []string{"/"}},
+		{"one level", 1, 10, []string{"/", "/a", "/b#top"}},
+		{"two levels", 2, 10, []string{"/", "/a", "/b#top", "/c"}},
+		{"page budget", 2, 2, []string{"/", "/a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, err := crawler.CrawlSite(context.Background(), server.URL+"/", CrawlOptions{MaxDepth: tt.maxDepth, MaxPages: tt.maxPages})
+			if err != nil {
+				t.Fatalf("CrawlSite() error = %v", err)
+			}
+			if len(pages) != len(tt.wantPages) {
+				t.Fatalf("CrawlSite() visited %d pages, want %d", len(pages), len(tt.wantPages))
+			}
+			for i, want := range tt.wantPages {
+				if pages[i].URL != server.URL+want {
+					t.Errorf("page %d = %s, want %s", i, pages[i].URL, server.URL+want)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateCrawl(t *testing.T) {
+	pages := []PageAnalysis{
+		{Result: &models.AnalysisResult{Title: "Home", HTMLVersion: "HTML5", H1Count: 1, InternalLinks: 3, BrokenLinks: 1}},
+		{Result: &models.AnalysisResult{Title: "B", H1Count: 2, H2Count: 1, ExternalLinks: 4, HasLoginForm: true}},
+	}
+
+	total := AggregateCrawl(pages)
+	if total.Title != "Home" || total.HTMLVersion != "HTML5" {
+		t.Errorf("AggregateCrawl() title/version = %q/%q, want Home/HTML5", total.Title, total.HTMLVersion)
+	}
+	if total.PagesCrawled != 2 || total.H1Count != 3 || total.H2Count != 1 {
+		t.Errorf("AggregateCrawl() pages/h1/h2 = %d/%d/%d, want 2/3/1", total.PagesCrawled, total.H1Count, total.H2Count)
+	}
+	if total.InternalLinks != 3 || total.ExternalLinks != 4 || total.BrokenLinks != 1 {
+		t.Errorf("AggregateCrawl() links = %d/%d/%d, want 3/4/1", total.InternalLinks, total.ExternalLinks, total.BrokenLinks)
+	}
+	if !total.HasLoginForm {
+		t.Error("AggregateCrawl() HasLoginForm = false, want true")
+	}
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// MaxSitemapURLs caps how many page URLs one import may collect
+	MaxSitemapURLs = 50000
+	// MaxSitemapFiles caps how many sitemap files a sitemap index may pull in
+	MaxSitemapFiles = 50
+	// maxSitemapSize is the uncompressed size limit from the sitemaps protocol
+	maxSitemapSize = 50 * 1024 * 1024
+	// MaxURLLength matches the size of the url column
+	MaxURLLength = 512
+)
+
+var ErrNotSitemap = errors.New("document is not a sitemap or sitemap index")
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// ParseSitemap parses a sitemap <urlset> or sitemap <sitemapindex>, which may
+// be gzip-compressed. It returns the page locations and the child sitemap
+// locations, at most one of which is non-empty.
+func ParseSitemap(r io.Reader) ([]string, []string, error) {
+	br := bufio.NewReader(r)
+	var body io.Reader = br
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress sitemap: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(io.LimitReader(body, maxSitemapSize)).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse sitemap: %w", err)
+	}
+
+	var pages, sitemaps []string
+	switch doc.XMLName.Local {
+	case "urlset":
+		for _, u := range doc.URLs {
+			pages = append(pages, strings.TrimSpace(u.Loc))
+		}
+	case "sitemapindex":
+		for _, s := range doc.Sitemaps {
+			sitemaps = append(sitemaps, strings.TrimSpace(s.Loc))
+		}
+	default:
+		return nil, nil, ErrNotSitemap
+	}
+	return pages, sitemaps, nil
+}
+
+// FetchSitemap downloads a sitemap and, for a sitemap index, every sitemap it
+// lists. Nested indexes are followed too, up to MaxSitemapFiles files and
+// MaxSitemapURLs page URLs in total. Entries are returned as found, without
+// normalization. If ctx ends first, the context error is returned.
+func (c *CrawlerService) FetchSitemap(ctx context.Context, sitemapURL string) ([]string, error) {
+	var pages []string
+	pending := []string{sitemapURL}
+	seen := map[string]bool{sitemapURL: true}
+	fetched := 0
+
+	for len(pending) > 0 && fetched < MaxSitemapFiles && len(pages) < MaxSitemapURLs {
+		current := pending[0]
+		pending = pending[1:]
+		fetched++
+
+		found, children, err := c.fetchSitemapFile(ctx, current)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			// The submitted sitemap must load; broken children are skipped
+			if current == sitemapURL {
+				return nil, err
+			}
+			continue
+		}
+
+		pages = append(pages, found...)
+		for _, child := range children {
+			if !seen[child] {
+				seen[child] = true
+				pending = append(pending, child)
+			}
+		}
+	}
+
+	if len(pages) > MaxSitemapURLs {
+		pages = pages[:MaxSitemapURLs]
+	}
+	return pages, nil
+}
+
+func (c *CrawlerService) fetchSitemapFile(ctx context.Context, sitemapURL string) ([]string, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", sitemapURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/xml,text/xml;q=0.9,*/*;q=0.8")
+
+	resp, err := c.do(req, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch sitemap: %s", c.sanitizeErrorMessage(err.Error()))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, nil, fmt.Errorf("failed to fetch sitemap: %s", getStatusMessage(resp.StatusCode))
+	}
+	return ParseSitemap(resp.Body)
+}
+
+// NormalizeURL validates a user-supplied URL and puts it in a canonical form
+// for deduplication: the scheme and host are lowercased and the fragment is
+// dropped. Only absolute http and https URLs are accepted.
+func NormalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("empty URL")
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.New("invalid URL format")
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", errors.New("URL must use http or https")
+	}
+	if parsed.Host == "" {
+		return "", errors.New("URL must include a host")
+	}
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	normalized := parsed.String()
+	if len(normalized) > MaxURLLength {
+		return "", fmt.Errorf("URL is longer than %d characters", MaxURLLength)
+	}
+	return normalized, nil
+}
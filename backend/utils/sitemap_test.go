@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gzipString(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatalf("Failed to gzip: %v", err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc> https://example.com/ </loc></url>
+	<url><loc>https://example.com/about</loc><lastmod>2024-01-01</lastmod></url>
+</urlset>`
+	index := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap>
+</sitemapindex>`
+
+	pages, sitemaps, err := ParseSitemap(strings.NewReader(urlset))
+	if err != nil {
+		t.Fatalf("ParseSitemap(urlset) error = %v", err)
+	}
+	if len(pages) != 2 || pages[0] != "https://example.com/" || len(sitemaps) != 0 {
+		t.Errorf("ParseSitemap(urlset) = %v, %v", pages, sitemaps)
+	}
+
+	pages, sitemaps, err = ParseSitemap(bytes.NewReader(gzipString(t, index)))
+	if err != nil {
+		t.Fatalf("ParseSitemap(gzipped index) error = %v", err)
+	}
+	if len(pages) != 0 || len(sitemaps) != 1 || sitemaps[0] != "https://example.com/sitemap-1.xml" {
+		t.Errorf("ParseSitemap(gzipped index) = %v, %v", pages, sitemaps)
+	}
+
+	if _, _, err := ParseSitemap(strings.NewReader("<html></html>")); !errors.Is(err, ErrNotSitemap) {
+		t.Errorf("ParseSitemap(html) error = %v, want ErrNotSitemap", err)
+	}
+}
+
+func TestFetchSitemapIndex(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%[1]s/a.xml.gz</loc></sitemap><sitemap><loc>%[1]s/missing.xml</loc></sitemap></sitemapindex>`, server.URL)
+		case "/a.xml.gz":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(gzipString(t, `<urlset><url><loc>https://example.com/a</loc></url><url><loc>https://example.com/b</loc></url></urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	pages, err := newTestCrawler().FetchSitemap(context.Background(), server.URL+"/sitemap.xml")
+	if err != nil {
+		t.Fatalf("FetchSitemap() error = %v", err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("FetchSitemap() = %v, want 2 pages", pages)
+	}
+
+	if _, err := newTestCrawler().FetchSitemap(context.Background(), server.URL+"/missing.xml"); err == nil {
+		t.Error("FetchSitemap() on a missing sitemap returned no error")
+	}
+}
+
+func TestFetchSitemapDeadline(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/slow.xml</loc></sitemap></sitemapindex>`, server.URL)
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := newTestCrawler().FetchSitemap(ctx, server.URL+"/sitemap.xml"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FetchSitemap() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+		wantErr  bool
+	}{
+		{"https://Example.COM/Path#frag", "https://example.com/Path", false},
+		{"  HTTP://example.com  ", "http://example.com", false},
+		{"https://example.com/?q=1", "https://example.com/?q=1", false},
+		{"ftp://example.com", "", true},
+		{"/relative/path", "", true},
+		{"", "", true},
+		{"https://example.com/" + strings.Repeat("a", MaxURLLength), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			result, err := NormalizeURL(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeURL(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, result, tt.expected)
+			}
+		})
+	}
+}
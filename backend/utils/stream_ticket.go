@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// StreamTicketTTL is how long a stream ticket may wait to be used
+	StreamTicketTTL = 30 * time.Second
+	// StreamTicketPrefix starts every stream ticket so they are not mistaken
+	// for API keys
+	StreamTicketPrefix = "st_"
+)
+
+type streamTicket struct {
+	keyID     uint
+	expiresAt time.Time
+}
+
+// StreamTickets hands out short-lived, single-use tickets that open one event
+// stream on behalf of an API key. Browsers can't set headers on EventSource
+// requests, so they pass a ticket in the URL instead of the key itself.
+type StreamTickets struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	tickets map[string]streamTicket
+}
+
+func NewStreamTickets() *StreamTickets {
+	return &StreamTickets{now: time.Now, tickets: make(map[string]streamTicket)}
+}
+
+// Issue returns a new ticket for the key and when it expires.
+func (t *StreamTickets) Issue(keyID uint) (string, time.Time, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := StreamTicketPrefix + hex.EncodeToString(buf)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	// Unused tickets are dropped here, so they cannot pile up
+	for id, issued := range t.tickets {
+		if !issued.expiresAt.After(now) {
+			delete(t.tickets, id)
+		}
+	}
+	expiresAt := now.Add(StreamTicketTTL)
+	t.tickets[HashAPIKey(ticket)] = streamTicket{keyID: keyID, expiresAt: expiresAt}
+	return ticket, expiresAt, nil
+}
+
+// Redeem uses up the ticket and returns the API key it was issued for. It
+// reports false for unknown, used and expired tickets.
+func (t *StreamTickets) Redeem(ticket string) (uint, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hash := HashAPIKey(ticket)
+	issued, ok := t.tickets[hash]
+	if !ok {
+		return 0, false
+	}
+	delete(t.tickets, hash)
+	return issued.keyID, issued.expiresAt.After(t.now())
+}
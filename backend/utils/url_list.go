@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MaxURLListEntries caps how many URLs one uploaded list may contain
+const MaxURLListEntries = 50000
+
+// ErrTooManyEntries is returned when an uploaded list exceeds MaxURLListEntries.
+var ErrTooManyEntries = fmt.Errorf("list has more than %d entries", MaxURLListEntries)
+
+// URLListEntry is one non-blank entry of an uploaded URL list.
+type URLListEntry struct {
+	Line  int
+	Value string
+}
+
+// ParseURLList reads URLs from plain text, one per line, ignoring blank lines
+// and lines starting with "#".
+func ParseURLList(r io.Reader) ([]URLListEntry, error) {
+	var entries []URLListEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		value := scanner.Text()
+		if line == 1 {
+			value = strings.TrimPrefix(value, "\ufeff")
+		}
+		value = strings.TrimSpace(value)
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+		if len(entries) == MaxURLListEntries {
+			return nil, ErrTooManyEntries
+		}
+		entries = append(entries, URLListEntry{Line: line, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read list: %w", err)
+	}
+	return entries, nil
+}
+
+// ParseURLCSV reads URLs from a CSV file. If the first row has a column named
+// "url" it is treated as a header and that column is used; otherwise the first
+// column of every row is.
+func ParseURLCSV(r io.Reader) ([]URLListEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var entries []URLListEntry
+	column := 0
+	first := true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		if first {
+			first = false
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			header := -1
+			for i, name := range record {
+				if strings.EqualFold(strings.TrimSpace(name), "url") {
+					header = i
+					break
+				}
+			}
+			if header >= 0 {
+				column = header
+				continue
+			}
+		}
+
+		line, _ := reader.FieldPos(0)
+		value := ""
+		if column < len(record) {
+			value = strings.TrimSpace(record[column])
+		}
+		if value == "" {
+			continue
+		}
+		if len(entries) == MaxURLListEntries {
+			return nil, ErrTooManyEntries
+		}
+		entries = append(entries, URLListEntry{Line: line, Value: value})
+	}
+	return entries, nil
+}
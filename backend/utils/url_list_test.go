@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseURLList(t *testing.T) {
+	input := "\ufeffhttps://example.com\n\n# comment\n  https://example.org/a  \r\nnot a url\n"
+
+	entries, err := ParseURLList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseURLList() error = %v", err)
+	}
+
+	expected := []URLListEntry{
+		{Line: 1, Value: "https://example.com"},
+		{Line: 4, Value: "https://example.org/a"},
+		{Line: 5, Value: "not a url"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("ParseURLList() returned %d entries, want %d: %+v", len(entries), len(expected), entries)
+	}
+	for i, want := range expected {
+		if entries[i] != want {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want)
+		}
+	}
+}
+
+func TestParseURLCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []URLListEntry
+	}{
+		{
+			name:  "header selects column",
+			input: "name,URL\nHome,https://example.com\n\"Quoted, name\",https://example.org\nMissing\n",
+			expected: []URLListEntry{
+				{Line: 2, Value: "https://example.com"},
+				{Line: 3, Value: "https://example.org"},
+			},
+		},
+		{
+			name:  "no header uses first column",
+			input: "https://example.com,extra\nhttps://example.org\n",
+			expected: []URLListEntry{
+				{Line: 1, Value: "https://example.com"},
+				{Line: 2, Value: "https://example.org"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseURLCSV(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ParseURLCSV() error = %v", err)
+			}
+			if len(entries) != len(tt.expected) {
+				t.Fatalf("ParseURLCSV() returned %+v, want %+v", entries, tt.expected)
+			}
+			for i, want := range tt.expected {
+				if entries[i] != want {
+					t.Errorf("entry %d = %+v, want %+v", i, entries[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseURLListLimit(t *testing.T) {
+	input := strings.Repeat("https://example.com\n", MaxURLListEntries+1)
+	if _, err := ParseURLList(strings.NewReader(input)); !errors.Is(err, ErrTooManyEntries) {
+		t.Errorf("ParseURLList() error = %v, want ErrTooManyEntries", err)
+	}
+}
@@ -0,0 +1,428 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is marked failed
+	MaxAttempts = 6
+	// InitialBackoff is the wait before the first retry; it doubles every attempt
+	InitialBackoff = 30 * time.Second
+	// MaxBackoff caps the wait between retries
+	MaxBackoff = time.Hour
+	// DefaultPollInterval is how often the dispatcher looks for due retries
+	DefaultPollInterval = 5 * time.Second
+	deliveryTimeout     = 10 * time.Second
+	deliveryBatchSize   = 100
+	// maxErrorBody is how much of a failed response body is kept in the log
+	maxErrorBody = 512
+	// deliveryLease keeps other pollers off a delivery while it is being sent,
+	// whether by Replay or DeliverDue; if the process dies mid-send, the
+	// delivery is retried once the lease runs out
+	deliveryLease = 2 * deliveryTimeout
+)
+
+const (
+	SignatureHeader = "X-Sykell-Signature"
+	TimestampHeader = "X-Sykell-Timestamp"
+	EventHeader     = "X-Sykell-Event"
+	DeliveryHeader  = "X-Sykell-Delivery"
+)
+
+// ErrNoEvents is returned by Replay when the webhook has never had a delivery.
+var ErrNoEvents = errors.New("webhook has no events to replay")
+
+// Dispatcher records webhook deliveries in the database and sends them,
+// retrying failures with exponential backoff.
+type Dispatcher struct {
+	db           *gorm.DB
+	client       *http.Client
+	pollInterval time.Duration
+	wake         chan struct{}
+	wg           sync.WaitGroup
+
+	// Status changes waiting to be turned into deliveries
+	mu        sync.Mutex
+	pending   []jobEvent
+	published chan struct{}
+}
+
+type jobEvent struct {
+	event models.WebhookEvent
+	job   models.AnalysisJob
+}
+
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{
+		db:           db,
+		client:       &http.Client{Timeout: deliveryTimeout},
+		pollInterval: DefaultPollInterval,
+		wake:         make(chan struct{}, 1),
+		published:    make(chan struct{}, 1),
+	}
+}
+
+// Sign returns the signature header value for a delivery: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscribes reports whether the webhook wants the event.
+func Subscribes(webhook models.Webhook, event models.WebhookEvent) bool {
+	if webhook.Events == "" {
+		return true
+	}
+	for _, e := range strings.Split(webhook.Events, ",") {
+		if e == string(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalysisStatusChanged is a jobs.StatusListener that publishes the job's new
+// status to subscribed webhooks. It only queues the event, so the queue is
+// never held up by the database; Start turns queued events into deliveries.
+func (d *Dispatcher) AnalysisStatusChanged(job models.AnalysisJob) {
+	event, ok := eventForJob(job.Status)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	d.pending = append(d.pending, jobEvent{event: event, job: job})
+	d.mu.Unlock()
+	signal(d.published)
+}
+
+func eventForJob(status string) (models.WebhookEvent, bool) {
+	switch models.JobStatus(status) {
+	case models.JobQueued:
+		return models.EventAnalysisQueued, true
+	case models.JobRunning:
+		return models.EventAnalysisRunning, true
+	case models.JobDone:
+		return models.EventAnalysisDone, true
+	case models.JobFailed:
+		return models.EventAnalysisError, true
+	case models.JobCancelled:
+		return models.EventAnalysisCancelled, true
+	}
+	return "", false
+}
+
+// Flush records a delivery of every queued event to each active webhook in
+// the job's workspace that is subscribed to it.
+func (d *Dispatcher) Flush() {
+	d.mu.Lock()
+	events := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+
+	// A batch enqueue publishes many events for one workspace at once
+	webhooksByWorkspace := make(map[uint][]models.Webhook)
+	var deliveries []models.WebhookDelivery
+	for _, e := range events {
+		webhooks, ok := webhooksByWorkspace[e.job.WorkspaceID]
+		if !ok {
+			if err := d.db.Where("active = ? AND workspace_id = ?", true, e.job.WorkspaceID).Find(&webhooks).Error; err != nil {
+				slog.Error("Failed to publish webhook event", "event", e.event, "job_id", e.job.ID, "request_id", e.job.RequestID, "error", err)
+				continue
+			}
+			webhooksByWorkspace[e.job.WorkspaceID] = webhooks
+		}
+		eventDeliveries, err := d.deliveriesFor(e.event, e.job, webhooks)
+		if err != nil {
+			slog.Error("Failed to publish webhook event", "event", e.event, "job_id", e.job.ID, "request_id", e.job.RequestID, "error", err)
+			continue
+		}
+		deliveries = append(deliveries, eventDeliveries...)
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := d.db.CreateInBatches(&deliveries, deliveryBatchSize).Error; err != nil {
+		slog.Error("Failed to record webhook deliveries", "deliveries", len(deliveries), "error", err)
+		return
+	}
+	signal(d.wake)
+}
+
+// deliveriesFor builds a pending delivery of the event for each webhook
+// subscribed to it.
+func (d *Dispatcher) deliveriesFor(event models.WebhookEvent, job models.AnalysisJob, webhooks []models.Webhook) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	var body []byte
+	for _, webhook := range webhooks {
+		if !Subscribes(webhook, event) {
+			continue
+		}
+		if body == nil {
+			payload, err := d.buildPayload(event, job)
+			if err != nil {
+				return nil, err
+			}
+			if body, err = json.Marshal(payload); err != nil {
+				return nil, err
+			}
+		}
+		now := time.Now()
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         string(event),
+			Payload:       string(body),
+			Status:        string(models.DeliveryPending),
+			NextAttemptAt: &now,
+		})
+	}
+	return deliveries, nil
+}
+
+func (d *Dispatcher) buildPayload(event models.WebhookEvent, job models.AnalysisJob) (models.WebhookPayload, error) {
+	payload := models.WebhookPayload{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Job:        job,
+	}
+	if err := d.db.First(&payload.URL, job.URLID).Error; err != nil {
+		return payload, err
+	}
+
+	if event == models.EventAnalysisDone {
+		var result models.AnalysisResult
+		err := d.db.Where("job_id = ? AND parent_id IS NULL", job.ID).First(&result).Error
+		if err == nil {
+			payload.Analysis = models.NewAnalysisSummary(result)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return payload, err
+		}
+	}
+	return payload, nil
+}
+
+// Replay sends the webhook's most recent event again as a new delivery and
+// returns that delivery after its first attempt. The delivery is recorded as
+// already claimed, so the poller does not send it at the same time.
+func (d *Dispatcher) Replay(ctx context.Context, webhook models.Webhook) (*models.WebhookDelivery, error) {
+	var last models.WebhookDelivery
+	err := d.db.Where("webhook_id = ?", webhook.ID).Order("id desc").First(&last).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoEvents
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	leaseEnd := time.Now().Add(deliveryLease)
+	delivery := models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         last.Event,
+		Payload:       last.Payload,
+		Status:        string(models.DeliveryPending),
+		NextAttemptAt: &leaseEnd,
+	}
+	if err := d.db.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	if err := d.attempt(ctx, webhook, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Start records published events and sends due deliveries until ctx is
+// cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.wg.Add(2)
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				// Keep the events still queued as deliveries for the next run
+				d.Flush()
+				return
+			case <-d.published:
+				d.Flush()
+			}
+		}
+	}()
+
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := d.DeliverDue(ctx); err != nil {
+				slog.Error("Failed to deliver webhooks", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait blocks until the goroutines started by Start have returned.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// signal wakes the goroutine waiting on ch without blocking the caller
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// DeliverDue attempts every pending delivery whose next attempt is due.
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+	for {
+		var due []models.WebhookDelivery
+		if err := d.db.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+			Order("id").
+			Limit(deliveryBatchSize).
+			Find(&due).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		for i := range due {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// Only the poller that moves the next attempt forward sends it
+			res := d.db.Model(&models.WebhookDelivery{}).
+				Where("id = ? AND status = ? AND next_attempt_at = ?", due[i].ID, models.DeliveryPending, due[i].NextAttemptAt).
+				Update("next_attempt_at", time.Now().Add(deliveryLease))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				continue
+			}
+
+			var webhook models.Webhook
+			if err := d.db.First(&webhook, due[i].WebhookID).Error; err != nil {
+				// The webhook was deleted; its pending deliveries go with it
+				d.db.Model(&due[i]).Updates(map[string]interface{}{
+					"status": models.DeliveryFailed,
+					"error":  "webhook no longer exists",
+				})
+				continue
+			}
+			if err := d.attempt(ctx, webhook, &due[i]); err != nil {
+				return err
+			}
+		}
+		if len(due) < deliveryBatchSize {
+			return nil
+		}
+	}
+}
+
+// attempt POSTs the delivery once and records the outcome, scheduling a
+// retry on failure. Only database errors are returned.
+func (d *Dispatcher) attempt(ctx context.Context, webhook models.Webhook, delivery *models.WebhookDelivery) error {
+	statusCode, sendErr := d.send(ctx, webhook, delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = statusCode
+	delivery.Error = ""
+	switch {
+	case sendErr == nil:
+		delivery.Status = string(models.DeliveryDelivered)
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = string(models.DeliveryFailed)
+		delivery.Error = sendErr.Error()
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(Backoff(delivery.Attempts))
+		delivery.Error = sendErr.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	return d.db.Model(delivery).
+		Select("status", "attempts", "response_status", "error", "next_attempt_at", "delivered_at").
+		Updates(delivery).Error
+}
+
+// Backoff is the wait before retrying a delivery that has failed attempts times.
+func Backoff(attempts int) time.Duration {
+	wait := InitialBackoff
+	for i := 1; i < attempts && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxBackoff {
+		wait = MaxBackoff
+	}
+	return wait
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SykellWebhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		msg := fmt.Sprintf("endpoint responded %d", resp.StatusCode)
+		if text := strings.TrimSpace(string(snippet)); text != "" {
+			msg += ": " + text
+		}
+		return resp.StatusCode, errors.New(msg)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	return resp.StatusCode, nil
+}
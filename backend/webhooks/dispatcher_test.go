@@ -0,0 +1,212 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/sykell/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testModels are the tables the dispatcher and its webhook events use
+var testModels = []any{&models.URL{}, &models.AnalysisResult{}, &models.AnalysisJob{},
+	&models.Webhook{}, &models.WebhookDelivery{}}
+
+// newTestDB opens a fresh SQLite database holding the given models. It is
+// closed when the test ends.
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, MaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.expected {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
+
+func TestSubscribes(t *testing.T) {
+	all := models.Webhook{}
+	some := models.Webhook{Events: "analysis.done,analysis.error"}
+
+	if !Subscribes(all, models.EventAnalysisRunning) {
+		t.Error("webhook without events should receive everything")
+	}
+	if !Subscribes(some, models.EventAnalysisError) {
+		t.Error("webhook should receive a listed event")
+	}
+	if Subscribes(some, models.EventAnalysisQueued) {
+		t.Error("webhook should not receive an unlisted event")
+	}
+}
+
+func TestDispatcherDeliversSignedPayload(t *testing.T) {
+	db := newTestDB(t, testModels...)
+
+	const secret = "test-secret-0123456789"
+	var calls int32
+	var received models.WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if r.Header.Get(SignatureHeader) != Sign(secret, timestamp, body) {
+			t.Errorf("signature %q does not match body", r.Header.Get(SignatureHeader))
+		}
+
+		// Fail the first attempt to exercise the retry path
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	url := models.URL{WorkspaceID: 1, URL: "https://example.com", Status: string(models.StatusDone)}
+	db.Create(&url)
+	job := models.AnalysisJob{URLID: url.ID, WorkspaceID: 1, Status: string(models.JobDone)}
+	db.Create(&job)
+	db.Create(&models.AnalysisResult{URLID: url.ID, JobID: &job.ID, Version: 1, Title: "Example"})
+	db.Create(&models.Webhook{WorkspaceID: 1, URL: server.URL, Secret: secret, Events: "analysis.done", Active: true})
+	// Another workspace's webhook must not hear about this job
+	db.Create(&models.Webhook{WorkspaceID: 2, URL: server.URL, Secret: secret, Active: true})
+
+	dispatcher := NewDispatcher(db)
+	dispatcher.AnalysisStatusChanged(models.AnalysisJob{ID: job.ID, URLID: url.ID, Status: string(models.JobRunning)})
+	dispatcher.AnalysisStatusChanged(job)
+	dispatcher.Flush()
+
+	if err := dispatcher.DeliverDue(context.Background()); err != nil {
+		t.Fatalf("DeliverDue() error = %v", err)
+	}
+
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if delivery.Status != string(models.DeliveryPending) || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("after failed attempt delivery = %+v, want pending retry", delivery)
+	}
+
+	// Make the retry due now instead of waiting out the backoff
+	db.Model(&delivery).Update("next_attempt_at", time.Now().Add(-time.Second))
+	if err := dispatcher.DeliverDue(context.Background()); err != nil {
+		t.Fatalf("DeliverDue() error = %v", err)
+	}
+
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != string(models.DeliveryDelivered) || delivery.Attempts != 2 {
+		t.Errorf("delivery = %+v, want delivered after 2 attempts", delivery)
+	}
+	if received.Event != models.EventAnalysisDone || received.Analysis == nil || received.Analysis.Title != "Example" {
+		t.Errorf("received payload = %+v, want analysis.done with summary", received)
+	}
+
+	var count int64
+	db.Model(&models.WebhookDelivery{}).Count(&count)
+	if count != 1 {
+		t.Errorf("deliveries = %d, want 1 (running event is not subscribed, other workspace is skipped)", count)
+	}
+}
+
+func TestReplayIsNotSentTwice(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	dispatcher := NewDispatcher(db)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The poller runs while Replay is still sending
+		if atomic.AddInt32(&calls, 1) == 1 {
+			if err := dispatcher.DeliverDue(r.Context()); err != nil {
+				t.Errorf("DeliverDue() error = %v", err)
+			}
+		}
+	}))
+	defer server.Close()
+
+	webhook := models.Webhook{WorkspaceID: 1, URL: server.URL, Secret: "test-secret-0123456789", Active: true}
+	db.Create(&webhook)
+	db.Create(&models.WebhookDelivery{WebhookID: webhook.ID, Event: string(models.EventAnalysisDone), Payload: "{}", Status: string(models.DeliveryDelivered)})
+
+	delivery, err := dispatcher.Replay(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if delivery.Status != string(models.DeliveryDelivered) || delivery.Attempts != 1 {
+		t.Errorf("delivery = %+v, want delivered after 1 attempt", delivery)
+	}
+	if calls != 1 {
+		t.Errorf("endpoint called %d times, want 1", calls)
+	}
+}
+
+func TestOverlappingPollersSendOnce(t *testing.T) {
+	db := newTestDB(t, testModels...)
+	first, second := NewDispatcher(db), NewDispatcher(db)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Another instance polls while the first is still sending
+		if atomic.AddInt32(&calls, 1) == 1 {
+			if err := second.DeliverDue(r.Context()); err != nil {
+				t.Errorf("DeliverDue() error = %v", err)
+			}
+		}
+	}))
+	defer server.Close()
+
+	webhook := models.Webhook{WorkspaceID: 1, URL: server.URL, Secret: "test-secret-0123456789", Active: true}
+	db.Create(&webhook)
+	due := time.Now().Add(-time.Second)
+	db.Create(&models.WebhookDelivery{WebhookID: webhook.ID, Event: string(models.EventAnalysisDone), Payload: "{}",
+		Status: string(models.DeliveryPending), NextAttemptAt: &due})
+
+	if err := first.DeliverDue(context.Background()); err != nil {
+		t.Fatalf("DeliverDue() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("endpoint called %d times, want 1", calls)
+	}
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if delivery.Status != string(models.DeliveryDelivered) || delivery.Attempts != 1 {
+		t.Errorf("delivery = %+v, want delivered after 1 attempt", delivery)
+	}
+}
@@ -1,7 +1,11 @@
 import axios from 'axios';
 
 const API_BASE_URL = process.env.REACT_APP_API_URL || 'http://localhost:8080';
-const API_TOKEN = 'sykell-api-token-2025';
+// The backend's FRONTEND_API_KEY or a key from POST /api/keys. It ends up in
+// the browser, so it must never be an admin key.
+const API_TOKEN = process.env.REACT_APP_API_TOKEN || '';
+// How long to wait before reopening a dropped event stream
+const EVENTS_RECONNECT_DELAY = 3000;
 
 // Create axios instance with default config
 const api = axios.create({
@@ -23,8 +27,16 @@ api.interceptors.response.use(
 
 export interface URL {
   id: number;
+  workspace_id: number;
   url: string;
-  status: 'queued' | 'running' | 'done' | 'error';
+  status: 'queued' | 'running' | 'done' | 'error' | 'cancelled';
+  crawl_mode: 'page' | 'site';
+  max_depth: number;
+  max_pages: number;
+  ignore_robots: boolean;
+  schedule: string;
+  next_run_at: string | null;
+  last_run_at: string | null;
   created_at: string;
   updated_at: string;
 }
@@ -33,6 +45,12 @@ export interface AnalysisResult {
   id: number;
   url_id: number;
   url: URL;
+  parent_id?: number;
+  version: number;
+  job_id?: number;
+  page_url?: string;
+  depth: number;
+  pages_crawled: number;
   title: string;
   html_version: string;
   h1_count: number;
@@ -44,6 +62,7 @@ export interface AnalysisResult {
   internal_links: number;
   external_links: number;
   broken_links: number;
+  disallowed_links: number;
   has_login_form: boolean;
   created_at: string;
   updated_at: string;
@@ -55,6 +74,7 @@ export interface BrokenLink {
   url: string;
   status_code: number;
   error_message: string;
+  outcome: 'broken' | 'disallowed' | 'rate_limited';
 }
 
 export interface URLListResponse {
@@ -65,13 +85,176 @@ export interface URLListResponse {
   total_pages: number;
 }
 
+export interface AnalysisHistoryResponse {
+  analyses: AnalysisResult[];
+  total: number;
+  page: number;
+  page_size: number;
+  total_pages: number;
+}
+
 export interface AnalysisDetailResponse {
   analysis_result: AnalysisResult;
   broken_links: BrokenLink[];
+  pages?: AnalysisResult[];
+}
+
+export interface CountDelta {
+  from: number;
+  to: number;
+  delta: number;
+}
+
+export interface AnalysisDiff {
+  url_id: number;
+  from: { id: number; version: number; created_at: string };
+  to: { id: number; version: number; created_at: string };
+  title: { changed: boolean; from: string; to: string };
+  html_version: { changed: boolean; from: string; to: string };
+  headings: Record<string, CountDelta>;
+  internal_links: CountDelta;
+  external_links: CountDelta;
+  broken_links: CountDelta;
+  newly_broken: BrokenLink[];
+  newly_fixed: BrokenLink[];
+  login_form: { from: boolean; to: boolean; change: 'appeared' | 'disappeared' | 'unchanged' };
+}
+
+export interface SitemapImportResponse {
+  found: number;
+  added: number;
+  skipped: number;
+  invalid: number;
+}
+
+export type WebhookEvent =
+  | 'analysis.queued'
+  | 'analysis.running'
+  | 'analysis.done'
+  | 'analysis.error'
+  | 'analysis.cancelled';
+
+export interface Webhook {
+  id: number;
+  workspace_id: number;
+  url: string;
+  secret?: string;
+  events: string;
+  active: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface WebhookDelivery {
+  id: number;
+  webhook_id: number;
+  event: WebhookEvent;
+  payload: string;
+  status: 'pending' | 'delivered' | 'failed';
+  attempts: number;
+  next_attempt_at: string | null;
+  response_status: number;
+  error: string;
+  delivered_at: string | null;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface WebhookDeliveryListResponse {
+  deliveries: WebhookDelivery[];
+  total: number;
+  page: number;
+  page_size: number;
+  total_pages: number;
+}
+
+export interface StreamTicket {
+  ticket: string;
+  expires_at: string;
+}
+
+export interface AnalysisEvent {
+  id: number;
+  type: 'status' | 'progress';
+  url_id: number;
+  job_id: number;
+  status?: string;
+  error?: string;
+  progress?: {
+    stage: 'fetching' | 'checking_links';
+    page: string;
+    pages_crawled: number;
+    max_pages: number;
+    links_to_check?: number;
+  };
+  time: string;
+}
+
+export interface BulkImportResponse {
+  total: number;
+  accepted: number;
+  duplicates: number;
+  rejected: number;
+  lines: {
+    line: number;
+    url: string;
+    status: 'accepted' | 'duplicate' | 'rejected';
+    reason?: string;
+  }[];
+}
+
+export interface AuditLogEntry {
+  id: number;
+  workspace_id: number;
+  api_key_id: number;
+  actor: string;
+  actor_prefix: string;
+  action: string;
+  target_type: string;
+  target_ids: number[];
+  details?: Record<string, unknown>;
+  ip: string;
+  created_at: string;
+}
+
+export interface AuditLogListResponse {
+  entries: AuditLogEntry[];
+  total: number;
+  page: number;
+  page_size: number;
+  total_pages: number;
+}
+
+export interface Workspace {
+  id: number;
+  name: string;
+  daily_analysis_quota: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export type APIKeyScope = 'urls:read' | 'urls:write' | 'urls:delete' | 'admin';
+
+export interface APIKey {
+  id: number;
+  workspace_id: number;
+  name: string;
+  prefix: string;
+  scopes: string;
+  daily_analysis_quota: number;
+  last_used_at: string | null;
+  expires_at: string | null;
+  revoked_at: string | null;
+  created_at: string;
+  updated_at: string;
 }
 
 export interface CreateURLRequest {
   url: string;
+  crawl_mode?: 'page' | 'site';
+  max_depth?: number;
+  max_pages?: number;
+  ignore_robots?: boolean;
 }
 
 // API functions
@@ -82,6 +265,22 @@ export const apiService = {
     return response.data;
   },
 
+  // Add every URL listed in a sitemap
+  importSitemap: async (url: string): Promise<SitemapImportResponse> => {
+    const response = await api.post<SitemapImportResponse>('/api/urls/sitemap', { url });
+    return response.data;
+  },
+
+  // Add every URL in a CSV or newline-delimited text file
+  importURLs: async (file: File): Promise<BulkImportResponse> => {
+    const form = new FormData();
+    form.append('file', file);
+    const response = await api.post<BulkImportResponse>('/api/urls/import', form, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
   // Get URLs with pagination and filters
   getURLs: async (params?: {
     page?: number;
@@ -95,12 +294,49 @@ export const apiService = {
     return response.data;
   },
 
+  // Download matching URLs with their latest analysis
+  exportURLs: async (params: {
+    format: 'csv' | 'json' | 'ndjson';
+    include?: 'broken_links';
+    search?: string;
+    status?: string;
+    sort_field?: string;
+    sort_direction?: 'asc' | 'desc';
+  }): Promise<Blob> => {
+    const response = await api.get<Blob>('/api/urls/export', { params, responseType: 'blob' });
+    return response.data;
+  },
+
   // Get URL details with analysis results
   getURLDetails: async (id: number): Promise<AnalysisDetailResponse> => {
     const response = await api.get<AnalysisDetailResponse>(`/api/urls/${id}`);
     return response.data;
   },
 
+  // List past analysis runs of a URL, newest first
+  getAnalysisHistory: async (id: number, params?: {
+    page?: number;
+    page_size?: number;
+  }): Promise<AnalysisHistoryResponse> => {
+    const response = await api.get<AnalysisHistoryResponse>(`/api/urls/${id}/analyses`, { params });
+    return response.data;
+  },
+
+  // Get a specific analysis run of a URL
+  getAnalysis: async (id: number, analysisId: number): Promise<AnalysisDetailResponse> => {
+    const response = await api.get<AnalysisDetailResponse>(`/api/urls/${id}/analyses/${analysisId}`);
+    return response.data;
+  },
+
+  // Compare two analysis runs; defaults to the previous run against the latest
+  diffAnalyses: async (id: number, params?: {
+    from?: number;
+    to?: number;
+  }): Promise<AnalysisDiff> => {
+    const response = await api.get<AnalysisDiff>(`/api/urls/${id}/analyses/diff`, { params });
+    return response.data;
+  },
+
   // Delete multiple URLs
   deleteURLs: async (ids: number[]): Promise<{ message: string }> => {
     const response = await api.delete<{ message: string }>('/api/urls', {
@@ -114,6 +350,168 @@ export const apiService = {
     const response = await api.post<{ message: string }>(`/api/urls/${id}/reanalyze`);
     return response.data;
   },
+
+  // Cancel a queued or running analysis
+  cancelAnalysis: async (id: number): Promise<{ message: string }> => {
+    const response = await api.post<{ message: string }>(`/api/urls/${id}/cancel`);
+    return response.data;
+  },
+
+  // Re-analyze a URL on a cron expression ("0 6 * * *") or interval ("24h")
+  setSchedule: async (id: number, schedule: string): Promise<URL> => {
+    const response = await api.put<URL>(`/api/urls/${id}/schedule`, { schedule });
+    return response.data;
+  },
+
+  // Stop recurring re-analysis of a URL
+  clearSchedule: async (id: number): Promise<URL> => {
+    const response = await api.delete<URL>(`/api/urls/${id}/schedule`);
+    return response.data;
+  },
+
+  // Subscribe a webhook; the response is the only time the secret is shown
+  createWebhook: async (data: { url: string; secret?: string; events?: WebhookEvent[] }): Promise<Webhook> => {
+    const response = await api.post<Webhook>('/api/webhooks', data);
+    return response.data;
+  },
+
+  getWebhooks: async (): Promise<{ webhooks: Webhook[] }> => {
+    const response = await api.get<{ webhooks: Webhook[] }>('/api/webhooks');
+    return response.data;
+  },
+
+  updateWebhook: async (id: number, data: { url?: string; events?: WebhookEvent[]; active?: boolean }): Promise<Webhook> => {
+    const response = await api.put<Webhook>(`/api/webhooks/${id}`, data);
+    return response.data;
+  },
+
+  deleteWebhook: async (id: number): Promise<{ message: string }> => {
+    const response = await api.delete<{ message: string }>(`/api/webhooks/${id}`);
+    return response.data;
+  },
+
+  getWebhookDeliveries: async (id: number, params?: {
+    page?: number;
+    page_size?: number;
+  }): Promise<WebhookDeliveryListResponse> => {
+    const response = await api.get<WebhookDeliveryListResponse>(`/api/webhooks/${id}/deliveries`, { params });
+    return response.data;
+  },
+
+  // Replay the webhook's last event
+  testWebhook: async (id: number): Promise<WebhookDelivery> => {
+    const response = await api.post<WebhookDelivery>(`/api/webhooks/${id}/test`);
+    return response.data;
+  },
+
+  // Stream status and progress events for the given URLs (all URLs if empty).
+  // EventSource can't send the API key, so each connection uses a single-use
+  // stream ticket; on errors it reconnects with a new ticket and resumes from
+  // the last event it saw. onReset is called when missed events could not be
+  // replayed. Returns a function that closes the stream.
+  subscribeToEvents: (
+    urlIds: number[],
+    onEvent: (event: AnalysisEvent) => void,
+    onReset?: () => void,
+  ): (() => void) => {
+    let source: EventSource | undefined;
+    let retry: ReturnType<typeof setTimeout> | undefined;
+    let lastEventId = '';
+    let closed = false;
+
+    const reconnect = () => {
+      if (!closed) {
+        retry = setTimeout(connect, EVENTS_RECONNECT_DELAY);
+      }
+    };
+    const connect = async () => {
+      let ticket: StreamTicket;
+      try {
+        ticket = (await api.post<StreamTicket>('/api/events/ticket')).data;
+      } catch {
+        reconnect();
+        return;
+      }
+      if (closed) return;
+
+      const params = new URLSearchParams({ ticket: ticket.ticket });
+      if (urlIds.length > 0) {
+        params.set('url_ids', urlIds.join(','));
+      }
+      if (lastEventId) {
+        params.set('last_event_id', lastEventId);
+      }
+      const stream = new EventSource(`${API_BASE_URL}/api/events?${params}`);
+      source = stream;
+      const handle = (message: MessageEvent) => {
+        lastEventId = message.lastEventId;
+        onEvent(JSON.parse(message.data));
+      };
+      stream.addEventListener('status', handle);
+      stream.addEventListener('progress', handle);
+      stream.addEventListener('reset', () => onReset?.());
+      // The ticket is used up, so EventSource's own retry would be rejected
+      stream.onerror = () => {
+        stream.close();
+        reconnect();
+      };
+    };
+
+    connect();
+    return () => {
+      closed = true;
+      clearTimeout(retry);
+      source?.close();
+    };
+  },
+
+  // Create an API key; the response is the only time the key is shown
+  createAPIKey: async (data: { name: string; scopes: APIKeyScope[]; daily_analysis_quota?: number; expires_at?: string }): Promise<APIKey & { key: string }> => {
+    const response = await api.post<APIKey & { key: string }>('/api/keys', data);
+    return response.data;
+  },
+
+  getAPIKeys: async (): Promise<{ keys: APIKey[] }> => {
+    const response = await api.get<{ keys: APIKey[] }>('/api/keys');
+    return response.data;
+  },
+
+  revokeAPIKey: async (id: number): Promise<APIKey> => {
+    const response = await api.delete<APIKey>(`/api/keys/${id}`);
+    return response.data;
+  },
+
+  getAuditLogs: async (params: {
+    page?: number;
+    page_size?: number;
+    action?: string;
+    api_key_id?: number;
+    target_type?: string;
+    target_id?: number;
+    since?: string;
+    until?: string;
+  } = {}): Promise<AuditLogListResponse> => {
+    const response = await api.get<AuditLogListResponse>('/api/audit-logs', { params });
+    return response.data;
+  },
+
+  getWorkspace: async (): Promise<Workspace> => {
+    const response = await api.get<Workspace>('/api/workspace');
+    return response.data;
+  },
+
+  createWorkspace: async (name: string, dailyAnalysisQuota = 0): Promise<{ workspace: Workspace; admin_key: APIKey & { key: string } }> => {
+    const response = await api.post<{ workspace: Workspace; admin_key: APIKey & { key: string } }>('/api/workspaces', {
+      name,
+      daily_analysis_quota: dailyAnalysisQuota,
+    });
+    return response.data;
+  },
+
+  setWorkspaceQuota: async (id: number, dailyAnalysisQuota: number): Promise<Workspace> => {
+    const response = await api.put<Workspace>(`/api/workspaces/${id}/quota`, { daily_analysis_quota: dailyAnalysisQuota });
+    return response.data;
+  },
 };
 
 export default api; 
\ No newline at end of file
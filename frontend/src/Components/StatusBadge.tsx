@@ -1,7 +1,7 @@
 import React from 'react';
 
 interface StatusBadgeProps {
-  status: 'queued' | 'running' | 'done' | 'error';
+  status: 'queued' | 'running' | 'done' | 'error' | 'cancelled';
 }
 
 const StatusBadge: React.FC<StatusBadgeProps> = ({ status }) => {
@@ -27,6 +27,11 @@ const StatusBadge: React.FC<StatusBadgeProps> = ({ status }) => {
           text: 'Error',
           className: 'bg-red-100 text-red-800 border-red-300'
         };
+      case 'cancelled':
+        return {
+          text: 'Cancelled',
+          className: 'bg-yellow-100 text-yellow-800 border-yellow-300'
+        };
       default:
         return {
           text: 'Unknown',
@@ -25,9 +25,6 @@ const URLTable: React.FC<URLTableProps> = ({ refreshTrigger }) => {
   const [sortField, setSortField] = useState<string>('created_at');
   const [sortDirection, setSortDirection] = useState<'asc' | 'desc'>('desc');
 
-  // Polling for status updates
-  const [pollingInterval, setPollingInterval] = useState<NodeJS.Timeout | null>(null);
-
   const fetchURLs = async () => {
     try {
       setLoading(true);
@@ -57,25 +54,24 @@ const URLTable: React.FC<URLTableProps> = ({ refreshTrigger }) => {
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, [page, search, statusFilter, sortField, sortDirection, refreshTrigger]);
 
-  // Set up polling for status updates
+  // Follow status changes of the visible URLs over Server-Sent Events
+  const visibleIds = urls.map(url => url.id).join(',');
   useEffect(() => {
-    if (pollingInterval) {
-      clearInterval(pollingInterval);
-    }
-
-    const interval = setInterval(() => {
-      fetchURLs();
-    }, 5000); // Poll every 5 seconds
-
-    setPollingInterval(interval);
+    if (!visibleIds) return;
 
-    return () => {
-      if (interval) {
-        clearInterval(interval);
-      }
-    };
+    return apiService.subscribeToEvents(
+      visibleIds.split(',').map(Number),
+      (event) => {
+        if (event.type !== 'status' || !event.status) return;
+        setUrls(prev => prev.map(url =>
+          url.id === event.url_id ? { ...url, status: event.status as URL['status'] } : url
+        ));
+      },
+      // Missed events can't be replayed, so reload the page instead
+      () => fetchURLs(),
+    );
     // eslint-disable-next-line react-hooks/exhaustive-deps
-  }, [page, search, statusFilter, sortField, sortDirection]);
+  }, [visibleIds]);
 
   const handleSelectAll = (checked: boolean) => {
     if (checked) {
@@ -185,6 +181,7 @@ const URLTable: React.FC<URLTableProps> = ({ refreshTrigger }) => {
               <option value="running">Running</option>
               <option value="done">Done</option>
               <option value="error">Error</option>
+              <option value="cancelled">Cancelled</option>
             </select>
           </div>
         </div>
@@ -53,7 +53,9 @@ const Details: React.FC = () => {
     );
   }
 
-  const { analysis_result, broken_links } = data;
+  const { analysis_result } = data;
+  // Links skipped because of robots.txt or rate limiting are not broken
+  const broken_links = (data.broken_links || []).filter((link) => (link.outcome || 'broken') === 'broken');
 
   // Check if analysis result exists and was successful
   const hasAnalysisData = analysis_result && analysis_result.title !== "";